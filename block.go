@@ -4,308 +4,1265 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"github.com/NebulousLabs/merkletree"
-	"crypto/sha512"
 	"github.com/lazyledger/smt"
+	"math"
+	"sort"
 )
 
-// Step defines the interval on which to compute intermediate state roots (must be a positive integer)
-const Step int = 2
-// ChunksSize defines the size of each chunk
-const chunksSize int = 256
+// chunkHeaderSize is the size of the header of a chunk, which holds the position of the first record starting in it.
+const chunkHeaderSize int = 4
+// noRecordStart is the header of a chunk in which no record starts.
+const noRecordStart uint32 = math.MaxUint32
+// rootIndexSize is the size of the index that a state root record holds before the state root.
+const rootIndexSize int = 8
 
 // Block is a block of the blockchain
 type Block struct {
     // data structure
+    prevHash     []byte // hash of the previous block header
+    height       uint64
     dataRoot     []byte
     stateRoot    []byte
-    transactions []Transaction
+    numTransactions uint64 // number of transactions committed by the header
+    transactions []Transaction // transactions decoded from the chunks
 
     // implementation specific
     prev            *Block // link to the previous block
-    dataTree        *merkletree.Tree // Merkle tree storing chunks
-    interStateRoots [][]byte // intermediate state roots (saved every 'step' transactions)
+    dataSquare      *dataSquare // extended data square committing to the chunks
+    chunks          [][]byte // chunks committed by the data root
+    prevStateRoot   []byte // state root on top of which the block is applied
+    interStateRoots [][]byte // intermediate state roots (saved every 'step' transactions, and after the last one)
+    params          *ChainParams // parameters of the chain
+    stateMachine    StateMachine // state transition function applied to the transactions
 }
 
-// NewBlock creates a new block with the given transactions.
-func NewBlock(t []Transaction, stateTree *smt.SparseMerkleTree) (*Block, error) {
+// NewBlock creates a new block with the given transactions, executed by the given state machine. The state tree must use
+// the hash function of the chain parameters. The serialized transactions and state roots must fit in MaxChunks chunks,
+// which caps the size of a block to about MaxChunks times the chunk size.
+func NewBlock(t []Transaction, stateTree *smt.SparseMerkleTree, params *ChainParams, sm StateMachine) (*Block, error) {
+	err := params.CheckParams()
+	if err != nil {
+		return nil, err
+	}
 	for i := 0; i < len(t); i++ {
-		err := t[i].CheckTransaction()
+		err := params.checkTransaction(&t[i])
 		if err != nil {
 			return nil, err
 		}
+		if i > 0 && bytes.Compare(t[i-1].namespace, t[i].namespace) > 0 {
+			return nil, errors.New("transactions should be sorted by namespace")
+		}
 	}
 
-	interStateRoots, stateRoot, err := fillStateTree(t, stateTree)
+	prevStateRoot := make([]byte, len(stateTree.Root()))
+	copy(prevStateRoot, stateTree.Root())
+	interStateRoots, stateRoot, err := fillStateTree(params, t, stateTree, sm)
 	if err != nil {
 		return nil, err
 	}
 
-	dataTree := merkletree.New(sha512.New512_256())
-	dataRoot, err := fillDataTree(t, interStateRoots, dataTree)
+	chunks, square, dataRoot, err := fillDataSquare(params, t, append([][]byte{prevStateRoot}, interStateRoots...))
 	if err != nil {
 		return nil, err
 	}
 
     return &Block{
+        nil,
+        0,
         dataRoot,
         stateRoot,
+		uint64(len(t)),
 		t,
         nil,
-		dataTree,
-		interStateRoots}, nil
+		square,
+		chunks,
+		prevStateRoot,
+		interStateRoots,
+		params,
+		sm}, nil
 }
 
 // fillStateTree fills the input state tree with key-values from the input transactions, and returns the state root and
 // the intermediate state roots.
-func fillStateTree(t []Transaction, stateTree *smt.SparseMerkleTree) ([][]byte, []byte, error){
-	var stateRoot []byte
+func fillStateTree(params *ChainParams, t []Transaction, stateTree *smt.SparseMerkleTree, sm StateMachine) ([][]byte, []byte, error){
+	stateRoot := make([]byte, len(stateTree.Root()))
+	copy(stateRoot, stateTree.Root())
 	var interStateRoots [][]byte
+	for i := 0; i < params.numOfWindows(len(t)); i++ {
+		root, err := applyTransactions(params.getWindow(t, i), stateTree, sm)
+		if err != nil {
+			return nil, nil, err
+		}
+		stateRoot = root
+		interStateRoots = append(interStateRoots, stateRoot)
+	}
+
+	return interStateRoots, stateRoot, nil
+}
+
+// applyTransactions applies the transactions to the state tree using the state machine, and returns the new state
+// root.
+func applyTransactions(t []Transaction, stateTree *smt.SparseMerkleTree, sm StateMachine) ([]byte, error) {
 	for i := 0; i < len(t); i++ {
-		for j := 0; j < len(t[i].writeKeys); j++ {
-			root, err := stateTree.Update(t[i].writeKeys[j], t[i].newData[j])
+		writeKeys, newData, err := sm.Apply(&t[i], stateTree)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < len(writeKeys); j++ {
+			_, err := stateTree.Update(writeKeys[j], newData[j])
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
-			stateRoot = make([]byte, len(root))
-			copy(stateRoot, root)
 		}
-
-		if i != 0 && i % Step == 0 {
-			interStateRoots = append(interStateRoots, stateRoot)
-		}
-	}
-	if len(t)%Step == 0 {
-		interStateRoots = append(interStateRoots, stateRoot)
 	}
 
-	return interStateRoots, stateRoot, nil
+	stateRoot := make([]byte, len(stateTree.Root()))
+	copy(stateRoot, stateTree.Root())
+	return stateRoot, nil
 }
 
-// fillDataTree fills the data tree and returns its root.
-func fillDataTree(t []Transaction, interStateRoots [][]byte, dataTree *merkletree.Tree) ([]byte, error) {
-	chunks, _, err := makeChunks(chunksSize, t, interStateRoots)
+// fillDataSquare splits the transactions and state roots into chunks, and returns the chunks, the extended data square
+// storing them and its data root.
+func fillDataSquare(params *ChainParams, t []Transaction, s [][]byte) ([][]byte, *dataSquare, []byte, error) {
+	chunks, _, namespaces, err := makeChunks(params, t, s)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	for i := 0; i < len(chunks); i++ {
-		dataTree.Push(chunks[i])
+	square, err := newDataSquare(params, chunks, namespaces)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	return dataTree.Root(), nil
+	return chunks, square, square.dataRoot(params), nil
 }
 
-// makeChunks splits a set of transactions and state roots into multiple chunks.
-func makeChunks(chunkSize int, t []Transaction, s [][]byte) ([][]byte, map[[256]byte]int, error) {
-	if len(s) != int(len(t)/Step) {
-		return nil, nil, errors.New("wrong number of intermediate state roots")
+// makeChunks splits a set of transactions and state roots into multiple chunks, and returns the chunks, the offset of
+// every record (transaction or state root) in the serialized data followed by the size of the serialized data, and the
+// range of namespaces of every chunk if the chain uses namespaces. The state roots are the one on top of which the block
+// is applied, followed by the intermediate state roots.
+//
+// The serialized data is the first state root followed by each window of 'Step' transactions and the state root
+// obtained after applying it. State roots are prefixed by a zero length so that they are never mistaken for
+// transactions, and by their index, so that the number of windows can be checked from the last one. Each chunk starts
+// with a header holding the position of the first record starting in it, or noRecordStart if none does. Missing state
+// roots are skipped and extra ones are appended at the end, so that incorrectly constructed blocks can be serialized
+// as well.
+//
+// A transaction belongs to its namespace, and a state root to the namespace of the transaction preceding it (the lowest
+// one for the first state root); the range of namespaces of a chunk is the one of the records it holds data of.
+func makeChunks(params *ChainParams, t []Transaction, s [][]byte) ([][]byte, []int, [][]byte, error) {
+	if len(s) == 0 {
+		return nil, nil, nil, errors.New("missing state root on top of which the block is applied")
 	}
-	interStateRoots := make([][]byte, len(s))
-	copy(interStateRoots, s)
 
-	var buff []byte
-	buffMap := make(map[[256]byte]int)
-	for i := 0; i < len(t); i++ {
-		buffMap[t[i].HashKey()] = len(buff)
-		buff = append(buff, t[i].Serialize()...)
-		if i != 0 && i%Step == 0 {
-			buff = append(buff, interStateRoots[0]...)
-			interStateRoots = interStateRoots[1:]
+	buff := serializeStateRoot(0, s[0])
+	offsets := []int{0}
+	namespace := make([]byte, params.NamespaceSize)
+	recordNamespaces := [][]byte{namespace}
+	for i := 0; i < params.numOfWindows(len(t)); i++ {
+		window := params.getWindow(t, i)
+		for j := 0; j < len(window); j++ {
+			namespace = params.namespaceID(&window[j])
+			offsets, recordNamespaces = append(offsets, len(buff)), append(recordNamespaces, namespace)
+			buff = append(buff, window[j].Serialize()...)
+		}
+		if i+1 < len(s) {
+			offsets, recordNamespaces = append(offsets, len(buff)), append(recordNamespaces, namespace)
+			buff = append(buff, serializeStateRoot(i+1, s[i+1])...)
 		}
 	}
-	if len(t)%Step == 0 {
-		buff = append(buff, interStateRoots[0]...)
+	for i := params.numOfWindows(len(t)) + 1; i < len(s); i++ {
+		offsets, recordNamespaces = append(offsets, len(buff)), append(recordNamespaces, namespace)
+		buff = append(buff, serializeStateRoot(i, s[i])...)
 	}
+	end := len(buff)
 
 	var chunk []byte
-	size := chunkSize - 1
+	size := params.ChunkSize - chunkHeaderSize
 	chunks := make([][]byte, 0, len(buff)/size+1)
 	for len(buff) >= size {
 		chunk, buff = buff[:size], buff[size:]
-		chunk = append([]byte{0x0}, chunk...)
+		chunk = append(makeChunkHeader(noRecordStart), chunk...)
 		chunks = append(chunks, chunk)
 	}
 	if len(buff) > 0 {
 		chunk = buff[:]
-		chunk = append([]byte{0x0}, chunk...)
+		chunk = append(makeChunkHeader(noRecordStart), chunk...)
 		chunks = append(chunks, chunk)
 	}
 
-	for i := len(t)-1; i >= 0; i-- {
-		chunkIndex := buffMap[t[i].HashKey()] / chunksSize
-		chunkPosition := byte(buffMap[t[i].HashKey()] % chunksSize)
-		chunks[chunkIndex][0] = chunkPosition
+	for i := len(offsets)-1; i >= 0; i-- {
+		chunkIndex := offsets[i] / size
+		chunkPosition := uint32(offsets[i] % size)
+		copy(chunks[chunkIndex], makeChunkHeader(chunkPosition))
 	}
 
-	return chunks, buffMap, nil
+	var namespaces [][]byte
+	if params.NamespaceSize > 0 {
+		namespaces = make([][]byte, len(chunks))
+		for i := 0; i < len(chunks); i++ {
+			lo := i * size
+			hi := lo + len(chunks[i]) - chunkHeaderSize
+			first := sort.SearchInts(offsets, lo+1) - 1
+			last := sort.SearchInts(offsets, hi) - 1
+			namespaces[i] = append(append([]byte{}, recordNamespaces[first]...), recordNamespaces[last]...)
+		}
+	}
+	offsets = append(offsets, end)
+
+	return chunks, offsets, namespaces, nil
 }
 
-// CheckBlock checks that the block is constructed correctly, and returns a fraud proof if it is not.
-func (b *Block) CheckBlock(stateTree *smt.SparseMerkleTree) (*FraudProof, error) {
-	rebuiltBlock, err := NewBlock(b.transactions, stateTree)
+// makeChunkHeader converts the position of the first record starting in a chunk into a chunk header.
+func makeChunkHeader(position uint32) []byte {
+	header := make([]byte, chunkHeaderSize)
+	binary.LittleEndian.PutUint32(header, position)
+	return header
+}
+
+// chunkHeader returns the position of the first record starting in a chunk, or noRecordStart.
+func chunkHeader(chunk []byte) uint32 {
+	return binary.LittleEndian.Uint32(chunk[:chunkHeaderSize])
+}
+
+// serializeStateRoot converts the k-th state root into a record of the serialized block data; its length prefix is zero,
+// which is never the length of a serialized transaction, and is followed by k.
+func serializeStateRoot(k int, root []byte) []byte {
+	record := make([]byte, 1+rootIndexSize, 1+rootIndexSize+len(root))
+	binary.LittleEndian.PutUint64(record[1:], uint64(k))
+	return append(record, root...)
+}
+
+// rootIndex returns the index of the state root held by a state root record.
+func rootIndex(record []byte) uint64 {
+	return binary.LittleEndian.Uint64(record[1:1+rootIndexSize])
+}
+
+// recordStateRoot returns the state root held by a state root record.
+func recordStateRoot(record []byte) []byte {
+	return record[1+rootIndexSize:]
+}
+
+// isStateRootRecord returns whether a record of the serialized block data holds a state root.
+func isStateRootRecord(record []byte) bool {
+	return len(record) > 0 && record[0] == 0
+}
+
+// recordBoundaries parses the serialized data from the given position, and returns the positions at which the parsed
+// records start, followed by the position at which the last one ends (which may be after the end of the data).
+func recordBoundaries(params *ChainParams, buff []byte, position int) []int {
+	boundaries := []int{position}
+	for position < len(buff) {
+		length, ok := params.recordLength(buff[position:])
+		if !ok {
+			break
+		}
+		position += length
+		boundaries = append(boundaries, position)
+	}
+	return boundaries
+}
+
+// expectedChunkHeader returns the header of a chunk holding the serialized data from lo to hi (excluded) given the
+// record boundaries of that data, and whether the boundaries determine it.
+func expectedChunkHeader(boundaries []int, lo int, hi int) (uint32, bool) {
+	for _, boundary := range boundaries {
+		if boundary >= hi {
+			return noRecordStart, true
+		}
+		if boundary >= lo {
+			return uint32(boundary - lo), true
+		}
+	}
+	return 0, false
+}
+
+// findBadChunk returns the index of a chunk whose size or header disagrees with the serialized data, or -1 if the chunks
+// are correctly formed. Chunks before a chunk with a bad header are correctly formed.
+func findBadChunk(params *ChainParams, chunks [][]byte) int {
+	var buff []byte
+	for i := 0; i < len(chunks); i++ {
+		if !params.checkChunkSize(chunks[i], uint64(i), uint64(len(chunks))) {
+			return i
+		}
+		buff = append(buff, chunks[i][chunkHeaderSize:]...)
+	}
+
+	boundaries := recordBoundaries(params, buff, 0)
+	lo := 0
+	for i := 0; i < len(chunks); i++ {
+		hi := lo + len(chunks[i]) - chunkHeaderSize
+		header, ok := expectedChunkHeader(boundaries, lo, hi)
+		if ok && header != chunkHeader(chunks[i]) {
+			return i
+		}
+		lo = hi
+	}
+	if boundaries[len(boundaries)-1] != len(buff) {
+		// the last record does not end at the end of the serialized data
+		return len(chunks) - 1
+	}
+	return -1
+}
+
+// parseChunks returns the records of the serialized data held by correctly formed chunks.
+func parseChunks(params *ChainParams, chunks [][]byte) [][]byte {
+	var buff []byte
+	for i := 0; i < len(chunks); i++ {
+		buff = append(buff, chunks[i][chunkHeaderSize:]...)
+	}
+	boundaries := recordBoundaries(params, buff, 0)
+	records := make([][]byte, len(boundaries)-1)
+	for i := 0; i < len(records); i++ {
+		records[i] = buff[boundaries[i]:boundaries[i+1]]
+	}
+	return records
+}
+
+// decodeChunks inverts makeChunks: it returns the transactions and the state roots serialized in the chunks of a block,
+// as far as they can be decoded. Nothing is decoded from incorrectly formed chunks, and records that are not valid
+// transactions are skipped; CheckBlock then shows that such blocks are invalid.
+func decodeChunks(params *ChainParams, chunks [][]byte) ([]Transaction, [][]byte) {
+	if len(chunks) == 0 || findBadChunk(params, chunks) >= 0 {
+		return nil, nil
+	}
+	var t []Transaction
+	var s [][]byte
+	for _, record := range parseChunks(params, chunks) {
+		if isStateRootRecord(record) {
+			s = append(s, recordStateRoot(record))
+			continue
+		}
+		tmp, err := Deserialize(record)
+		if err == nil {
+			t = append(t, *tmp)
+		}
+	}
+	return t, s
+}
+
+// rebuildBlock rebuilds a block from its header, its transactions and its state roots (the one on top of which it is
+// applied, followed by the intermediate ones), and checks that the block matches its header.
+func rebuildBlock(header *BlockHeader, t []Transaction, s [][]byte, params *ChainParams, sm StateMachine) (*Block,
+	error) {
+	chunks, square, dataRoot, err := fillDataSquare(params, t, s)
 	if err != nil {
 		return nil, err
 	}
+	if !bytes.Equal(dataRoot, header.dataRoot) || !bytes.Equal(header.paramsDigest, params.Digest()) ||
+		header.numTransactions != uint64(len(t)) || header.numChunks != uint64(len(chunks)) {
+		return nil, errors.New("the block does not match its header")
+	}
 
-	// verify that every intermediate state roots are constructed correctly
-	for i := 0; i < len(rebuiltBlock.interStateRoots); i++ {
-		if len(b.interStateRoots) <= i || !bytes.Equal(rebuiltBlock.interStateRoots[i], b.interStateRoots[i]) {
-			// 1. get the transactions causing the (first) invalid intermediate state
-			t := rebuiltBlock.transactions[i*Step:(i+1)*Step]
-
-			// 2. generate Merkle proofs of the keys-values contained in the transaction
-			var writeKeys, oldData, readKeys, readData [][]byte
-			for j := 0; j < len(t); j++ {
-				for k := 0; k < len(t[j].writeKeys); k++ {
-					writeKeys = append(writeKeys, t[j].writeKeys[k])
-					oldData = append(oldData, t[j].oldData[k])
-				}
-				for k := 0; k < len(t[j].readKeys); k++ {
-					readKeys = append(readKeys, t[j].readKeys[k])
-					readData = append(readData, t[j].readData[k])
-				}
-			}
+	return &Block{
+		header.prevHash,
+		header.height,
+		header.dataRoot,
+		header.stateRoot,
+		header.numTransactions,
+		t,
+		nil,
+		square,
+		chunks,
+		s[0],
+		s[1:],
+		params,
+		sm}, nil
+}
 
-			proofstate := make([]smt.SparseCompactMerkleProof, len(writeKeys))
-			for j := 0; j < len(writeKeys); j++ {
-				proof, err := stateTree.ProveCompact(writeKeys[j])
-				if err != nil {
-					return nil, err
-				}
-				proofstate[j] = proof
-			}
+// findStateRootCountFraud scans consecutive records of the serialized data of a block with n transactions for missing or
+// extra state roots, and returns the kind of fraud found along with the first and last records showing it; the first
+// record is -1 if none is found. The flags tell whether the records start at the beginning and end at the end of the
+// serialized data.
+func findStateRootCountFraud(params *ChainParams, records [][]byte, start bool, end bool, n int) (FraudProofKind, int, int) {
+	// 1. the serialized data starts with a transaction, or with a state root whose index is not zero
+	if start && !isStateRootRecord(records[0]) {
+		return MissingStateRootFraud, 0, 0
+	}
+	if start && rootIndex(records[0]) != 0 {
+		return MissingStateRootFraud, 0, 0
+	}
 
-			// 3. get chunks concerned by the proof
-			// TODO compact 'makeChunks' and 'getChunksIndexes'
-			chunksIndexes, _, err := b.getChunksIndexes(t)
-			if err != nil {
-				return nil, err
-			}
-			chunks, _, err := makeChunks(chunksSize, b.transactions, b.interStateRoots)
-			if err != nil {
-				return nil, err
+	// 2. a window holds more than 'Step' transactions, no transaction, or less than 'Step' transactions while it is not
+	// the last one, or the indexes of the state roots around it do not follow each other
+	prevRoot, lastRoot, run := -1, -1, 0
+	for i := 0; i < len(records); i++ {
+		if !isStateRootRecord(records[i]) {
+			run++
+			if lastRoot >= 0 && run > params.Step {
+				return MissingStateRootFraud, lastRoot, i
 			}
-			var concernedChunks [][]byte
-			for j := 0; j < len(chunksIndexes); j++ {
-				concernedChunks = append(concernedChunks, chunks[chunksIndexes[j]])
+			continue
+		}
+		if lastRoot >= 0 && run == 0 {
+			return ExtraStateRootFraud, lastRoot, i
+		}
+		if lastRoot >= 0 && run < params.Step && i+1 < len(records) && !isStateRootRecord(records[i+1]) {
+			return ExtraStateRootFraud, lastRoot, i + 1
+		}
+		if lastRoot >= 0 && rootIndex(records[i]) > rootIndex(records[lastRoot])+1 {
+			return MissingStateRootFraud, lastRoot, i
+		}
+		if lastRoot >= 0 && rootIndex(records[i]) <= rootIndex(records[lastRoot]) {
+			return ExtraStateRootFraud, lastRoot, i
+		}
+		prevRoot, lastRoot, run = lastRoot, i, 0
+	}
+	if !end {
+		return 0, -1, -1
+	}
+
+	// 3. the serialized data does not end with a state root, its last state root is not the one closing the number of
+	// windows implied by n, or its last window does not hold the number of transactions implied by n
+	if run > 0 {
+		return MissingStateRootFraud, len(records) - 1, len(records) - 1
+	}
+	if rootIndex(records[lastRoot]) < uint64(params.numOfWindows(n)) {
+		return MissingStateRootFraud, lastRoot, lastRoot
+	}
+	if rootIndex(records[lastRoot]) > uint64(params.numOfWindows(n)) {
+		return ExtraStateRootFraud, lastRoot, lastRoot
+	}
+	if prevRoot >= 0 && lastRoot-prevRoot-1 > params.lastWindowSize(n) {
+		return MissingStateRootFraud, prevRoot, lastRoot
+	}
+	if prevRoot >= 0 && lastRoot-prevRoot-1 < params.lastWindowSize(n) {
+		return ExtraStateRootFraud, prevRoot, lastRoot
+	}
+	return 0, -1, -1
+}
+
+// recordNamespaces returns the namespace of every record, and whether they can all be determined: a transaction belongs
+// to its namespace, and a state root to the namespace of the record preceding it (the lowest one for the first state
+// root of the serialized data). The flag tells whether the records start at the beginning of the serialized data.
+func recordNamespaces(params *ChainParams, records [][]byte, start bool) ([][]byte, bool) {
+	namespaces := make([][]byte, len(records))
+	for i, record := range records {
+		if isStateRootRecord(record) && i > 0 {
+			namespaces[i] = namespaces[i-1]
+			continue
+		}
+		if isStateRootRecord(record) {
+			if !start {
+				return nil, false
 			}
+			namespaces[i] = make([]byte, params.NamespaceSize)
+			continue
+		}
+		t, err := Deserialize(record)
+		if err != nil || len(t.namespace) != params.NamespaceSize {
+			return nil, false
+		}
+		namespaces[i] = t.namespace
+	}
+	return namespaces, true
+}
 
-			// 4. generate Merkle proofs of the transactions, previous state root, and next state root
-			proofChunks := make([][][]byte, len(chunksIndexes))
-			var numOfLeaves uint64
-			for j := 0; j < len(chunksIndexes); j++ {
-				// merkletree.Tree cannot call SetIndex on Tree if Tree has not been reset
-				// a dirty workaround is to copy the data tree
-				tmpDataTree := merkletree.New(sha512.New512_256())
-				err = tmpDataTree.SetIndex(chunksIndexes[j])
-				if err != nil {
-					return nil, err
-				}
-				_, err := fillDataTree(b.transactions, b.interStateRoots, tmpDataTree)
-				if err != nil {
-					return nil, err
-				}
-				_, proof, _, leaves := tmpDataTree.Prove()
-				numOfLeaves = leaves
-				proofChunks[j] = proof
+// findUnsortedNamespace returns the index of a record whose namespace is lower than the one of the record preceding it,
+// or -1 if the records are sorted by namespace.
+func findUnsortedNamespace(namespaces [][]byte) int {
+	for i := 1; i < len(namespaces); i++ {
+		if bytes.Compare(namespaces[i-1], namespaces[i]) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// findMislabelledShare scans consecutive chunks for a chunk whose range of namespaces, given by the share holding it,
+// differs from the one of the records it holds data of. The records start at the given position of the data of the
+// chunks, and only the chunks whose data belongs entirely to the records are checked. It returns the index of the
+// chunk along with its first and last records, or -1 if none is found.
+func findMislabelledShare(chunks [][]byte, labels [][]byte, records [][]byte, namespaces [][]byte, position int) (int,
+	int, int) {
+	offsets := []int{position}
+	for _, record := range records {
+		offsets = append(offsets, offsets[len(offsets)-1]+len(record))
+	}
+	lo := 0
+	for i := 0; i < len(chunks); i++ {
+		hi := lo + len(chunks[i]) - chunkHeaderSize
+		if lo >= offsets[0] && hi <= offsets[len(offsets)-1] && hi > lo {
+			first := sort.SearchInts(offsets, lo+1) - 1
+			last := sort.SearchInts(offsets, hi) - 1
+			if !bytes.Equal(labels[i], append(append([]byte{}, namespaces[first]...), namespaces[last]...)) {
+				return i, first, last
 			}
+		}
+		lo = hi
+	}
+	return -1, -1, -1
+}
+
+// anchorRecord returns the last transaction up to the i-th record, from which the namespaces of the records up to the
+// i-th one follow, or the first record if there is none.
+func anchorRecord(records [][]byte, i int) int {
+	for i > 0 && isStateRootRecord(records[i]) {
+		i--
+	}
+	return i
+}
+
+// anchorChunk returns the last chunk, up to the i-th one, in which a record starts.
+func anchorChunk(chunks [][]byte, i int) int {
+	for i > 0 && chunkHeader(chunks[i]) == noRecordStart {
+		i--
+	}
+	return i
+}
+
+// CheckBlock checks that the block is constructed correctly, and returns a fraud proof if it is not.
+// The parent is the header of the parent block, or nil for a first block, and the state tree must be at its state root
+// (the empty state for a first block). The writes of the block are applied to the state tree, so callers that may
+// reject the block should pass a tree backed by a copy-on-write view of their state.
+func (b *Block) CheckBlock(stateTree *smt.SparseMerkleTree, parent *BlockHeader) (*FraudProof, error) {
+	parentStateRoot := b.params.emptyStateRoot()
+	if parent != nil {
+		parentStateRoot = parent.stateRoot
+	}
+	if (parent == nil && len(b.prevHash) != 0) || (parent != nil && !bytes.Equal(parent.Hash(), b.prevHash)) {
+		return nil, errors.New("the given header is not the one of the parent block")
+	}
+	if !bytes.Equal(stateTree.Root(), parentStateRoot) {
+		return nil, errors.New("the state tree is not at the state root of the parent block")
+	}
+
+	// verify that the data square is correctly erasure coded
+	axis, err := b.dataSquare.findBadAxis(b.params)
+	if err != nil {
+		return nil, err
+	}
+	if axis >= 0 {
+		return b.generateBadErasureCodingFraudProof(axis)
+	}
 
-			return &FraudProof{
-				writeKeys,
-				oldData,
-				readKeys,
-				readData,
-				proofstate,
-				concernedChunks,
-				proofChunks,
-				chunksIndexes,
-				numOfLeaves}, nil
+	// verify that the chunks are correctly formed
+	k := findBadChunk(b.params, b.chunks)
+	if k >= 0 {
+		return b.generateBadEncodingFraudProof(k)
+	}
+
+	// verify that the state roots are where the number of transactions places them
+	records := parseChunks(b.params, b.chunks)
+	kind, first, last := findStateRootCountFraud(b.params, records, true, true, int(b.numTransactions))
+	if first >= 0 {
+		return b.proveRecords(kind, first, last)
+	}
+
+	// verify that the block is applied on top of the state of its parent, and leads to the state of its header
+	if !bytes.Equal(b.prevStateRoot, parentStateRoot) {
+		return b.generateParentStateRootFraudProof(parent)
+	}
+	if !bytes.Equal(b.postStateRoot(), b.stateRoot) {
+		return b.generateHeaderStateRootFraudProof()
+	}
+
+	// verify that every committed transaction decodes to a valid transaction
+	j := 0
+	for _, record := range records {
+		if isStateRootRecord(record) {
+			continue
+		}
+		t, err := Deserialize(record)
+		if err != nil || len(record) > b.params.MaxTransactionSize || b.params.checkTransaction(t) != nil {
+			return b.generateInvalidTransactionFraudProof(j)
+		}
+		j++
+	}
+
+	// verify that the transactions are sorted by namespace, and that every share holds the range of namespaces of the
+	// records of its chunk
+	if b.params.NamespaceSize > 0 {
+		namespaces, _ := recordNamespaces(b.params, records, true)
+		i := findUnsortedNamespace(namespaces)
+		if i >= 0 {
+			return b.proveRecords(UnsortedNamespaceFraud, anchorRecord(records, i-1), i)
+		}
+		k := squareWidth(uint64(len(b.chunks)))
+		labels := make([][]byte, len(b.chunks))
+		for c := 0; c < len(labels); c++ {
+			labels[c] = b.dataSquare.shares[(c/k)*b.dataSquare.width+c%k][:2*b.params.NamespaceSize]
+		}
+		_, first, last := findMislabelledShare(b.chunks, labels, records, namespaces, 0)
+		if first >= 0 {
+			return b.proveRecords(MislabelledShareFraud, anchorRecord(records, first), last)
 		}
 	}
 
+	// verify that every window of transactions is valid and leads to the committed intermediate state root
+	prevStateRoot := b.prevStateRoot
+	for i := 0; i < b.params.numOfWindows(len(b.transactions)); i++ {
+		stateRoot, err := applyTransactions(b.params.getWindow(b.transactions, i), stateTree, b.stateMachine)
+		if err != nil && err != ErrInvalidTransaction {
+			return nil, err
+		}
+		if err == ErrInvalidTransaction || !bytes.Equal(stateRoot, b.interStateRoots[i]) {
+			// the state root on top of which the window is applied is correct since the previous ones are
+			return b.generateFraudProof(i, prevStateRoot, stateTree)
+		}
+		prevStateRoot = stateRoot
+	}
 
 	return nil, nil
 }
 
-// getChunksIndexes returns the indexes and number of chunks in which the given transactions are included
-func (b *Block) getChunksIndexes(t []Transaction) ([]uint64, uint64, error) {
-	chunks, buffMap, err := makeChunks(chunksSize, b.transactions, b.interStateRoots)
+// generateFraudProof generates a fraud proof for the i-th window of transactions, which is applied on top of the
+// given state root.
+func (b *Block) generateFraudProof(i int, prevStateRoot []byte, stateTree *smt.SparseMerkleTree) (*FraudProof, error) {
+	// 1. get the transactions of the window
+	t := b.params.getWindow(b.transactions, i)
+
+	// 2. re-run the transactions to find the keys-values they read and write, and generate their Merkle proofs
+	// against the previous state root
+	state := &windowState{stateTree, prevStateRoot, make(map[string][]byte), nil}
+	var writeKeys [][]byte
+	for j := 0; j < len(t); j++ {
+		keys, values, err := b.stateMachine.Apply(&t[j], state)
+		if err == ErrInvalidTransaction {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k := 0; k < len(keys); k++ {
+			state.writes[string(keys[k])] = values[k]
+		}
+		writeKeys = append(writeKeys, keys...)
+	}
+	writeKeys, oldData, proofState, err := proveKeys(uniqueKeys(writeKeys), prevStateRoot, stateTree)
+	if err != nil {
+		return nil, err
+	}
+	readKeys, readData, proofReadState, err := proveKeys(uniqueKeys(state.readKeys), prevStateRoot, stateTree)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. generate Merkle proofs of the transactions, previous state root, and next state root
+	n := int(b.numTransactions)
+	fp, err := b.proveRecords(StateTransitionFraud, b.params.rootRecordIndex(i, n), b.params.rootRecordIndex(i+1, n))
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	fp.writeKeys, fp.oldData, fp.proofState = writeKeys, oldData, proofState
+	fp.readKeys, fp.readData, fp.proofReadState = readKeys, readData, proofReadState
+	return fp, nil
+}
+
+// generateInvalidTransactionFraudProof generates a fraud proof showing that the i-th transaction is malformed or
+// invalid.
+func (b *Block) generateInvalidTransactionFraudProof(i int) (*FraudProof, error) {
+	return b.proveRecords(InvalidTransactionFraud, b.params.transactionRecordIndex(i), b.params.transactionRecordIndex(i))
+}
+
+// generateHeaderStateRootFraudProof generates a fraud proof showing that the last committed state root differs from the
+// state root of the header.
+func (b *Block) generateHeaderStateRootFraudProof() (*FraudProof, error) {
+	n := int(b.numTransactions)
+	last := b.params.rootRecordIndex(b.params.numOfWindows(n), n)
+	return b.proveRecords(HeaderStateRootFraud, last, last)
+}
+
+// generateParentStateRootFraudProof generates a fraud proof showing that the first committed state root differs from
+// the state root of the header of the parent block (nil for a first block).
+func (b *Block) generateParentStateRootFraudProof(parent *BlockHeader) (*FraudProof, error) {
+	fp, err := b.proveRecords(ParentStateRootFraud, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		fp.parentHeader, err = parent.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fp, nil
+}
+
+// generateBadEncodingFraudProof generates a fraud proof showing that the k-th chunk is incorrectly formed; the chunks
+// before it must be correctly formed.
+func (b *Block) generateBadEncodingFraudProof(k int) (*FraudProof, error) {
+	first := k
+	if k > 0 && b.params.checkChunkSize(b.chunks[k], uint64(k), uint64(len(b.chunks))) {
+		// the header of the k-th chunk disagrees with the records parsed from the previous chunks
+		first = anchorChunk(b.chunks, k-1)
 	}
 
 	var chunksIndexes []uint64
-	for i := 0; i < len(t); i++ {
-		index := uint64(buffMap[t[i].HashKey()]/chunksSize)
-		length := int(binary.LittleEndian.Uint16(t[i].Serialize()[:MaxSize]))
-		last := length/chunksSize
-		for j := 0; j <= last; j++ {
-			chunksIndexes = append(chunksIndexes, index + uint64(j))
+	for j := first; j <= k; j++ {
+		chunksIndexes = append(chunksIndexes, uint64(j))
+	}
+	return b.proveChunks(BadEncodingFraud, chunksIndexes, 0)
+}
+
+// generateBadErasureCodingFraudProof generates a fraud proof showing that the row or column with the given axis is not
+// correctly erasure coded, from the first half of its shares. If its root is malformed, no share can be proven against
+// it, and the fraud proof holds the Merkle proof of the root against the data root instead.
+func (b *Block) generateBadErasureCodingFraudProof(axis int) (*FraudProof, error) {
+	k := b.dataSquare.width / 2
+	if !checkAxisRoot(b.params, b.dataSquare.roots()[axis]) {
+		proof, err := merkleProof(b.params, b.dataSquare.roots(), axis)
+		if err != nil {
+			return nil, err
 		}
-		if length > (chunksSize - buffMap[t[i].HashKey()]%chunksSize) {
-			chunksIndexes = append(chunksIndexes, index+uint64(last)+1) // ugly fix
+		return &FraudProof{
+			BadErasureCodingFraud,
+			b.Header().Hash(),
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			[][][]byte{proof},
+			nil,
+			uint64(len(b.chunks)),
+			0,
+			uint64(axis),
+			nil}, nil
+	}
+	shares := b.dataSquare.axisShares(axis)[:k]
+	proofShares := make([][][]byte, k)
+	sharesIndexes := make([]uint64, k)
+	for j := 0; j < k; j++ {
+		proof, err := b.dataSquare.proveShare(b.params, axis, j)
+		if err != nil {
+			return nil, err
 		}
+		proofShares[j], sharesIndexes[j] = proof, uint64(j)
 	}
 
-	uniquesMap := make(map[uint64]bool)
-	var uniques []uint64
-	for _, entry := range chunksIndexes {
-		if _, value := uniquesMap[entry]; !value {
-			uniquesMap[entry] = true
-			uniques = append(uniques, entry)
+	return &FraudProof{
+		BadErasureCodingFraud,
+		b.Header().Hash(),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		append([][]byte{}, shares...),
+		proofShares,
+		sharesIndexes,
+		uint64(len(b.chunks)),
+		0,
+		uint64(axis),
+		nil}, nil
+}
+
+// proveRecords returns a fraud proof of the given kind holding the chunks that contain the records from first to last
+// (included), and their Merkle proofs.
+func (b *Block) proveRecords(kind FraudProofKind, first int, last int) (*FraudProof, error) {
+	var offsets []int
+	position := 0
+	for _, record := range parseChunks(b.params, b.chunks) {
+		offsets = append(offsets, position)
+		position += len(record)
+	}
+	offsets = append(offsets, position)
+	chunksIndexes, recordIndex := getChunksIndexes(b.params, offsets, first, last)
+	return b.proveChunks(kind, chunksIndexes, recordIndex)
+}
+
+// proveChunks returns a fraud proof of the given kind holding the chunks with the given indexes, and their Merkle
+// proofs.
+func (b *Block) proveChunks(kind FraudProofKind, chunksIndexes []uint64, recordIndex uint64) (*FraudProof, error) {
+	// 1. get chunks concerned by the proof
+	chunks := b.chunks
+	var concernedChunks [][]byte
+	for j := 0; j < len(chunksIndexes); j++ {
+		concernedChunks = append(concernedChunks, chunks[chunksIndexes[j]])
+	}
+
+	// 2. generate Merkle proofs of the shares holding the chunks in the data square
+	proofChunks := make([][][]byte, len(chunksIndexes))
+	k := squareWidth(uint64(len(chunks)))
+	for j := 0; j < len(chunksIndexes); j++ {
+		proof, err := b.dataSquare.proveShare(b.params, int(chunksIndexes[j])/k, int(chunksIndexes[j])%k)
+		if err != nil {
+			return nil, err
 		}
+		proofChunks[j] = proof
 	}
 
-	return uniques, uint64(len(chunks)), nil
+	return &FraudProof{
+		kind,
+		b.Header().Hash(),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		concernedChunks,
+		proofChunks,
+		chunksIndexes,
+		uint64(len(chunks)),
+		recordIndex,
+		0,
+		nil}, nil
+}
+
+// uniqueKeys returns the given keys without duplicates.
+func uniqueKeys(keys [][]byte) [][]byte {
+	uniquesMap := make(map[string]bool)
+	var uniques [][]byte
+	for _, key := range keys {
+		if !uniquesMap[string(key)] {
+			uniquesMap[string(key)] = true
+			uniques = append(uniques, key)
+		}
+	}
+	return uniques
+}
+
+// proveKeys returns the values of the given keys at the given state root, and their Merkle proofs.
+func proveKeys(keys [][]byte, stateRoot []byte, stateTree *smt.SparseMerkleTree) ([][]byte, [][]byte, []smt.SparseCompactMerkleProof, error) {
+	values := make([][]byte, len(keys))
+	proofs := make([]smt.SparseCompactMerkleProof, len(keys))
+	for i := 0; i < len(keys); i++ {
+		value, err := stateTree.GetForRoot(keys[i], stateRoot)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		proof, err := stateTree.ProveCompactForRoot(keys[i], stateRoot)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		values[i], proofs[i] = value, proof
+	}
+	return keys, values, proofs, nil
+}
+
+// getChunksIndexes returns the indexes of the chunks containing the records from first to last (included), and the
+// index of the first record among the records starting in the first chunk. The serialized data can be parsed from the
+// first chunk since the first record starts in it.
+func getChunksIndexes(params *ChainParams, offsets []int, first int, last int) ([]uint64, uint64) {
+	firstChunk, lastChunk := params.chunkRange(offsets[first], offsets[last+1])
+
+	var chunksIndexes []uint64
+	for j := firstChunk; j <= lastChunk; j++ {
+		chunksIndexes = append(chunksIndexes, uint64(j))
+	}
+
+	recordIndex := 0
+	for j := first - 1; j >= 0 && offsets[j] >= firstChunk*(params.ChunkSize-chunkHeaderSize); j-- {
+		recordIndex++
+	}
+
+	return chunksIndexes, uint64(recordIndex)
+}
+
+// Header returns the header of the block.
+func (b *Block) Header() *BlockHeader {
+	return NewBlockHeader(b.prevHash, b.height, b.dataRoot, b.stateRoot, b.numTransactions,
+		uint64(len(b.chunks)), b.params.Digest())
+}
+
+// SetParent makes the block a child of the block with the given header, or a first block if the header is nil. Since it
+// changes the header of the block, it must be called before the block is shared.
+func (b *Block) SetParent(parent *BlockHeader) {
+	if parent == nil {
+		b.prevHash, b.height = nil, 0
+		return
+	}
+	b.prevHash, b.height = parent.Hash(), parent.height+1
+}
+
+// postStateRoot returns the state root after applying the transactions of the block, ie. its last intermediate state
+// root.
+func (b *Block) postStateRoot() []byte {
+	if len(b.interStateRoots) == 0 {
+		return b.prevStateRoot
+	}
+	return b.interStateRoots[len(b.interStateRoots)-1]
 }
 
 // VerifyFraudProof verifies whether or not a fraud proof is valid.
 func (b *Block) VerifyFraudProof(fp FraudProof) bool {
-	// 1. check that the transactions, prevStateRoot, nextStateRoot are in the data tree
+	return VerifyFraudProof(b.Header(), fp, b.params, b.stateMachine)
+}
+
+// VerifyFraudProof verifies whether or not a fraud proof is valid against a block header. It does not require the
+// block's transactions, so light clients holding only headers and the chain parameters can use it. The fraud proof
+// must name the block by the hash of its header, and the header must commit to the given parameters.
+//
+// A state transition fraud proof is valid if applying the window of transactions it contains on top of the state root
+// preceding them, using the given state machine, fails or leads to a state root different from the one committed after
+// them. The other kinds do not depend on the state machine: an invalid transaction fraud proof is valid if the
+// transaction it contains is malformed, invalid, too large or of a namespace the chain does not admit, a bad encoding
+// fraud proof is valid if the chunks it contains are incorrectly formed, and a missing (or extra) state root fraud proof
+// is valid if the records it contains show that a state root is missing from (or added to) the positions fixed by the
+// header's number of transactions. A bad erasure coding fraud proof is valid if half of the shares of a row or column
+// of the data square recover shares that its root does not commit to, or if that root is malformed. A header (or
+// parent) state root fraud proof is valid if the last (or first) committed state root differs from the state root of
+// the header (or of the parent header it contains, or from the empty state for a first block). A mislabelled share
+// fraud proof is valid if the range of namespaces of a share it contains differs from the one of the records of its
+// chunk, and an unsorted namespace fraud proof if the transactions it contains are not sorted by namespace.
+// Fraud proofs do not check without a header and parameters, and state transition fraud proofs without a state machine.
+func VerifyFraudProof(header *BlockHeader, fp FraudProof, params *ChainParams, sm StateMachine) bool {
+	// 1. check that the fraud proof accuses the block, and that the block uses the parameters
+	if header == nil || params == nil {
+		return false
+	}
+	if !bytes.Equal(fp.blockHash, header.Hash()) || !bytes.Equal(header.paramsDigest, params.Digest()) {
+		return false
+	}
+
+	// 2. check that the chunks are in the data square; the shares of a bad erasure coding fraud proof are checked along
+	// with the fraud
+	if fp.kind == BadErasureCodingFraud {
+		return verifyBadErasureCodingFraudProof(params, header, fp)
+	}
+	if len(fp.chunks) == 0 || len(fp.chunks) != len(fp.proofChunks) || len(fp.chunks) != len(fp.chunksIndexes) {
+		return false
+	}
+	k := squareWidth(header.numChunks)
+	if fp.numOfLeaves != header.numChunks || 2*k > maxSquareWidth {
+		return false
+	}
 	for i := 0; i < len(fp.proofChunks); i++ {
-		ret := merkletree.VerifyProof(sha512.New512_256(), b.dataRoot, fp.proofChunks[i], fp.chunksIndexes[i], fp.numOfLeaves)
-		if ret != true {
+		if i > 0 && fp.chunksIndexes[i] != fp.chunksIndexes[i-1]+1 {
+			return false
+		}
+		if fp.chunksIndexes[i] >= header.numChunks {
+			return false
+		}
+		if len(fp.proofChunks[i]) == 0 || !bytes.Equal(shareChunk(params, fp.proofChunks[i][0]), fp.chunks[i]) {
+			return false
+		}
+		row, col := int(fp.chunksIndexes[i])/k, int(fp.chunksIndexes[i])%k
+		if !verifyShareProof(params, header.dataRoot, fp.proofChunks[i][0], fp.proofChunks[i], row, col, 2*k) {
 			return false
 		}
 	}
 
-	// 2. extract new data from chunks
-	var indexes []int
+	// 3. verify the fraud according to its kind
+	switch fp.kind {
+	case StateTransitionFraud:
+		if sm == nil {
+			return false
+		}
+		records, _ := parseRecords(params, fp)
+		return verifyStateTransitionFraudProof(params, records, fp, sm)
+	case InvalidTransactionFraud:
+		records, _ := parseRecords(params, fp)
+		return verifyInvalidTransactionFraudProof(params, records)
+	case BadEncodingFraud:
+		return verifyBadEncodingFraudProof(params, fp)
+	case MissingStateRootFraud, ExtraStateRootFraud:
+		return verifyStateRootCountFraudProof(params, fp, int(header.numTransactions))
+	case HeaderStateRootFraud:
+		return verifyHeaderStateRootFraudProof(params, header, fp)
+	case ParentStateRootFraud:
+		return verifyParentStateRootFraudProof(params, header, fp)
+	case MislabelledShareFraud:
+		return verifyMislabelledShareFraudProof(params, fp)
+	case UnsortedNamespaceFraud:
+		return verifyUnsortedNamespaceFraudProof(params, fp)
+	}
+	return false
+}
+
+// parseRecords parses the chunks of a fraud proof from the first record starting in the first chunk, and returns the
+// records following the first 'recordIndex' ones and whether they end at the end of the chunks. Records that do not
+// end in the chunks are dropped.
+func parseRecords(params *ChainParams, fp FraudProof) ([][]byte, bool) {
+	return chunkRecords(params, fp.chunks, fp.recordIndex)
+}
+
+// chunkRecords parses consecutive chunks from the first record starting in the first chunk, and returns the records
+// following the first 'skip' ones and whether they end at the end of the chunks. Records that do not end in the chunks
+// are dropped.
+func chunkRecords(params *ChainParams, chunks [][]byte, skip uint64) ([][]byte, bool) {
 	var buff []byte
-	for i := 0; i < len(fp.chunks); i++ {
-		indexes = append(indexes, int(fp.chunks[i][0]))
-		buff = append(buff, fp.chunks[i][1:]...)
+	for i := 0; i < len(chunks); i++ {
+		if len(chunks[i]) < chunkHeaderSize {
+			return nil, false
+		}
+		buff = append(buff, chunks[i][chunkHeaderSize:]...)
+	}
+	if len(chunks) == 0 {
+		return nil, false
+	}
+	position := chunkHeader(chunks[0])
+	if position == noRecordStart || int64(position) > int64(len(buff)) {
+		return nil, false
 	}
+	buff = buff[position:]
 
-	var newData [][]byte
-	buff = buff[indexes[0]:]
-	for i := 0; len(buff) >= MaxSize; i++ {
-		length := int(binary.LittleEndian.Uint16(buff[:MaxSize]))
-		if len(buff) < length {
+	var records [][]byte
+	for i := uint64(0); len(buff) > 0; i++ {
+		length, ok := params.recordLength(buff)
+		if !ok || len(buff) < length {
 			break
 		}
-		t, _ := Deserialize(buff[:length])
+		if i >= skip {
+			records = append(records, buff[:length])
+		}
 		buff = buff[length:]
-		newData = append(newData, t.newData...)
 	}
+	return records, len(buff) == 0
+}
 
-	// 3. check keys-values contained in the transaction are in the state tree for old data
-	subtree := smt.NewDeepSparseMerkleSubTree(smt.NewSimpleMap(), sha512.New512_256(), b.stateRoot)
+// verifyInvalidTransactionFraudProof verifies that the first proven record is a malformed or invalid transaction, or a
+// transaction the chain does not admit.
+func verifyInvalidTransactionFraudProof(params *ChainParams, records [][]byte) bool {
+	if len(records) == 0 || isStateRootRecord(records[0]) {
+		return false
+	}
+	if len(records[0]) > params.MaxTransactionSize {
+		return true
+	}
+	t, err := Deserialize(records[0])
+	return err != nil || params.checkTransaction(t) != nil
+}
+
+// verifyStateRootCountFraudProof verifies that the proven records show a missing or extra state root (according to the
+// kind of the fraud proof) in the serialized data of a block with n transactions.
+func verifyStateRootCountFraudProof(params *ChainParams, fp FraudProof, n int) bool {
+	records, complete := parseRecords(params, fp)
+	if len(records) == 0 {
+		return false
+	}
+	start := fp.chunksIndexes[0] == 0 && fp.recordIndex == 0
+	end := complete && fp.chunksIndexes[len(fp.chunksIndexes)-1] == fp.numOfLeaves-1
+	kind, first, _ := findStateRootCountFraud(params, records, start, end, n)
+	return first >= 0 && kind == fp.kind
+}
+
+// verifyHeaderStateRootFraudProof verifies that the last proven record ends the serialized data, and is a state root
+// different from the one of the header.
+func verifyHeaderStateRootFraudProof(params *ChainParams, header *BlockHeader, fp FraudProof) bool {
+	records, complete := parseRecords(params, fp)
+	if len(records) == 0 || !complete || fp.chunksIndexes[len(fp.chunksIndexes)-1] != fp.numOfLeaves-1 {
+		return false
+	}
+	last := records[len(records)-1]
+	return isStateRootRecord(last) && !bytes.Equal(recordStateRoot(last), header.stateRoot)
+}
+
+// verifyParentStateRootFraudProof verifies that the first record of the serialized data is a state root different from
+// the one of the parent header, or from the empty state for a first block.
+func verifyParentStateRootFraudProof(params *ChainParams, header *BlockHeader, fp FraudProof) bool {
+	// 1. get the state root of the parent block
+	parentStateRoot := params.emptyStateRoot()
+	if len(header.prevHash) != 0 {
+		parent := &BlockHeader{}
+		if parent.UnmarshalBinary(fp.parentHeader) != nil || !bytes.Equal(parent.Hash(), header.prevHash) {
+			return false
+		}
+		parentStateRoot = parent.stateRoot
+	}
+
+	// 2. check the first record against it
+	records, _ := parseRecords(params, fp)
+	if len(records) == 0 || fp.chunksIndexes[0] != 0 || fp.recordIndex != 0 || !isStateRootRecord(records[0]) {
+		return false
+	}
+	return !bytes.Equal(recordStateRoot(records[0]), parentStateRoot)
+}
+
+// verifyMislabelledShareFraudProof verifies that the range of namespaces of a proven share differs from the one of the
+// records its chunk holds data of.
+func verifyMislabelledShareFraudProof(params *ChainParams, fp FraudProof) bool {
+	// 1. get the namespaces of the proven records, and the ranges of namespaces of the shares
+	records, _ := parseRecords(params, fp)
+	start := fp.chunksIndexes[0] == 0 && fp.recordIndex == 0
+	namespaces, ok := recordNamespaces(params, records, start)
+	if params.NamespaceSize == 0 || len(records) == 0 || !ok {
+		return false
+	}
+	labels := make([][]byte, len(fp.chunks))
+	for i := 0; i < len(labels); i++ {
+		if len(fp.proofChunks[i][0]) != params.shareSize() {
+			return false
+		}
+		labels[i] = fp.proofChunks[i][0][:2*params.NamespaceSize]
+	}
+
+	// 2. find the position of the first proven record, and check the chunks holding data of the proven records only
+	var buff []byte
+	for i := 0; i < len(fp.chunks); i++ {
+		buff = append(buff, fp.chunks[i][chunkHeaderSize:]...)
+	}
+	position := int(chunkHeader(fp.chunks[0]))
+	for i := uint64(0); i < fp.recordIndex; i++ {
+		length, _ := params.recordLength(buff[position:])
+		position += length
+	}
+	i, _, _ := findMislabelledShare(fp.chunks, labels, records, namespaces, position)
+	return i >= 0
+}
+
+// verifyUnsortedNamespaceFraudProof verifies that the proven records hold transactions that are not sorted by
+// namespace.
+func verifyUnsortedNamespaceFraudProof(params *ChainParams, fp FraudProof) bool {
+	records, _ := parseRecords(params, fp)
+	start := fp.chunksIndexes[0] == 0 && fp.recordIndex == 0
+	namespaces, ok := recordNamespaces(params, records, start)
+	return params.NamespaceSize > 0 && ok && findUnsortedNamespace(namespaces) >= 0
+}
+
+// verifyBadEncodingFraudProof verifies that a chunk has an invalid size or header, or that a chunk header or the end
+// of the serialized data disagrees with the records parsed from the first chunk.
+func verifyBadEncodingFraudProof(params *ChainParams, fp FraudProof) bool {
+	// 1. check the size and header of every chunk
+	var buff []byte
+	for i := 0; i < len(fp.chunks); i++ {
+		if !params.checkChunkSize(fp.chunks[i], fp.chunksIndexes[i], fp.numOfLeaves) {
+			return true
+		}
+		header := chunkHeader(fp.chunks[i])
+		if header != noRecordStart && int64(header) >= int64(len(fp.chunks[i])-chunkHeaderSize) {
+			return true
+		}
+		buff = append(buff, fp.chunks[i][chunkHeaderSize:]...)
+	}
+
+	// 2. parse the records from the first chunk (the serialized data starts at the beginning of the first chunk)
+	position, first := int(chunkHeader(fp.chunks[0])), 1
+	if fp.chunksIndexes[0] == 0 {
+		position, first = 0, 0
+	} else if chunkHeader(fp.chunks[0]) == noRecordStart {
+		return false
+	}
+	boundaries := recordBoundaries(params, buff, position)
+
+	// 3. check that the headers of the next chunks agree with the records
+	lo := 0
+	for i := 0; i < len(fp.chunks); i++ {
+		hi := lo + len(fp.chunks[i]) - chunkHeaderSize
+		header, ok := expectedChunkHeader(boundaries, lo, hi)
+		if i >= first && ok && header != chunkHeader(fp.chunks[i]) {
+			return true
+		}
+		lo = hi
+	}
+
+	// 4. check that the last record ends at the end of the serialized data
+	if fp.chunksIndexes[len(fp.chunksIndexes)-1] == fp.numOfLeaves-1 && boundaries[len(boundaries)-1] != len(buff) {
+		return true
+	}
+	return false
+}
+
+// verifyBadErasureCodingFraudProof verifies that half of the shares of a row or column, proven against its root, are
+// the Reed-Solomon codeword of shares with another root, or that the root of the row or column is malformed.
+func verifyBadErasureCodingFraudProof(params *ChainParams, header *BlockHeader, fp FraudProof) bool {
+	// 1. check that the shares are in distinct positions of the accused row or column
+	k := squareWidth(header.numChunks)
+	width := 2 * k
+	if fp.numOfLeaves != header.numChunks || width > maxSquareWidth || fp.axisIndex >= uint64(2*width) {
+		return false
+	}
+	if len(fp.chunks) == 0 && len(fp.proofChunks) == 1 && len(fp.proofChunks[0]) > 0 {
+		// the root itself is malformed
+		return verifyRootProof(params, header.dataRoot, fp.proofChunks[0], int(fp.axisIndex), width) &&
+			!checkAxisRoot(params, fp.proofChunks[0][0])
+	}
+	if len(fp.chunks) != k || len(fp.proofChunks) != k || len(fp.chunksIndexes) != k {
+		return false
+	}
+	shares := make([][]byte, width)
+	for i := 0; i < k; i++ {
+		position := fp.chunksIndexes[i]
+		if position >= uint64(width) || shares[position] != nil || len(fp.chunks[i]) != params.shareSize() {
+			return false
+		}
+		if !verifyShareProof(params, header.dataRoot, fp.chunks[i], fp.proofChunks[i], int(fp.axisIndex),
+			int(position), width) {
+			return false
+		}
+		shares[position] = fp.chunks[i]
+	}
+
+	// 2. recover the other shares, and check that they do not match the root of the row or column
+	shares, err := recoverAxis(shares)
+	if err != nil {
+		return false
+	}
+	return !bytes.Equal(axisRoot(params, int(fp.axisIndex), shares), fp.proofChunks[0][proofSize(width)])
+}
+
+// verifyStateTransitionFraudProof verifies that the proven window of transactions, applied on top of the state root
+// preceding it, does not lead to the state root following it.
+func verifyStateTransitionFraudProof(params *ChainParams, records [][]byte, fp FraudProof, sm StateMachine) bool {
+	// 1. extract the previous state root, the transactions, and the next state root
+	if len(records) == 0 || !isStateRootRecord(records[0]) {
+		return false
+	}
+	prevStateRoot := recordStateRoot(records[0])
+	var t []*Transaction
+	var nextStateRoot []byte
+	for i := 1; i < len(records) && nextStateRoot == nil; i++ {
+		if isStateRootRecord(records[i]) {
+			nextStateRoot = recordStateRoot(records[i])
+			continue
+		}
+		tx, err := Deserialize(records[i])
+		if err != nil {
+			return false
+		}
+		t = append(t, tx)
+	}
+	if nextStateRoot == nil || len(t) == 0 || len(t) > params.Step {
+		return false
+	}
+
+	// 2. check keys-values read and written by the transactions are in the state tree for old data
+	subtree := smt.NewDeepSparseMerkleSubTree(smt.NewSimpleMap(), params.Hash(), prevStateRoot)
+	if len(fp.writeKeys) != len(fp.oldData) || len(fp.writeKeys) != len(fp.proofState) {
+		return false
+	}
+	if len(fp.readKeys) != len(fp.readData) || len(fp.readKeys) != len(fp.proofReadState) {
+		return false
+	}
+	writeKeysMap := make(map[string]bool)
+	state := make(proofState)
 	for i := 0; i < len(fp.writeKeys); i++ {
-		proof, err := smt.DecompactProof(fp.proofState[i], sha512.New512_256())
+		proof, err := smt.DecompactProof(fp.proofState[i], params.Hash())
 		if err != nil {
 			return false
 		}
-		err = subtree.AddBranch(proof, fp.writeKeys[i], newData[i])
+		err = subtree.AddBranch(proof, fp.writeKeys[i], fp.oldData[i])
 		if err != nil {
 			return false
 		}
-		// 4. update keys with new data
-		_, err = subtree.Update(fp.writeKeys[i], newData[i])
+		writeKeysMap[string(fp.writeKeys[i])] = true
+		state[string(fp.writeKeys[i])] = fp.oldData[i]
+	}
+	for i := 0; i < len(fp.readKeys); i++ {
+		ret := smt.VerifyCompactProof(fp.proofReadState[i], prevStateRoot, fp.readKeys[i], fp.readData[i], params.Hash())
+		if ret != true {
+			return false
+		}
+		state[string(fp.readKeys[i])] = fp.readData[i]
+	}
+
+	// 3. re-run the transactions with the state machine and update keys with new data
+	for i := 0; i < len(t); i++ {
+		writeKeys, newData, err := sm.Apply(t[i], state)
+		if err == ErrInvalidTransaction {
+			return true
+		}
 		if err != nil {
 			return false
 		}
+		for j := 0; j < len(writeKeys); j++ {
+			if !writeKeysMap[string(writeKeys[j])] {
+				return false
+			}
+			_, err := subtree.Update(writeKeys[j], newData[j])
+			if err != nil {
+				return false
+			}
+			state[string(writeKeys[j])] = newData[j]
+		}
 	}
-	if !bytes.Equal(b.stateRoot, subtree.Root()) {
+
+	// 4. the state root after the transactions differs from the committed one
+	if bytes.Equal(nextStateRoot, subtree.Root()) {
 		return false
 	}
 
@@ -1,41 +1,408 @@
 package fraudproofs
 
 import (
+	"bytes"
+	"errors"
+	"github.com/asonnino/fraudproofs-prototype/pb"
 	"github.com/lazyledger/smt"
-	"crypto/sha512"
+	"google.golang.org/protobuf/proto"
 )
 
-// Blockchain is a simple blockchain.
+// Keys under which a blockchain is persisted in its storage.
+var (
+	statePrefix   = []byte("state/")   // nodes of the state tree
+	headerPrefix  = []byte("header/")  // block headers, by hash
+	bodyPrefix    = []byte("body/")    // block bodies, by hash
+	invalidPrefix = []byte("invalid/") // hashes of the blocks shown invalid by a fraud proof
+	treePrefix    = []byte("tree/")    // hashes of the blocks of the block tree
+	tipKey        = []byte("tip")      // hash of the last block of the longest chain
+)
+
+// InvalidBlockEvent is emitted by a blockchain when a fraud proof shows that a block is invalid.
+type InvalidBlockEvent struct {
+	Proof  *FraudProof // fraud proof showing that the block is invalid
+	Blocks [][]byte    // hashes of the accused block and of its descendants, pruned from the block tree
+	Last   *Block      // last block of the longest chain after the blocks are pruned (nil if the blockchain is empty)
+}
+
+// Blockchain is a simple blockchain. It holds a tree of blocks in which the longest chain wins.
 type Blockchain struct {
 	// data structure
-	length int
-	last *Block
+	length int // length of the longest chain
+	last *Block // last block of the longest chain
+	blocks map[string]*Block // valid blocks of every branch, by header hash
 
 	// implementation specific
 	stateTree *smt.SparseMerkleTree // sparse Merkle tree storing key-values of the transactions
+	params *ChainParams // parameters of the chain
+	stateMachine StateMachine // state machine of the chain
+	storage Storage // storage persisting the state tree and the blocks
+	listeners []func(InvalidBlockEvent) // functions called on every invalid block event
+	rules []AdmissionRule // rules a block must pass before being checked, such as data availability sampling
 }
 
-// NewBlockchain creates an empty blockchain.
-func NewBlockchain() *Blockchain {
-	return &Blockchain{0,nil, smt.NewSparseMerkleTree(smt.NewSimpleMap(), sha512.New512_256())}
+// NewBlockchain creates a blockchain with the given parameters and state machine, persisted in the given storage. If
+// the storage already holds a blockchain, it is reopened.
+func NewBlockchain(params *ChainParams, sm StateMachine, storage Storage) (*Blockchain, error) {
+	err := params.CheckParams()
+	if err != nil {
+		return nil, err
+	}
+	stateStore := prefixStore{storage, statePrefix}
+	bc := &Blockchain{
+		0,
+		nil,
+		make(map[string]*Block),
+		smt.NewSparseMerkleTree(stateStore, params.Hash()),
+		params,
+		sm,
+		storage,
+		nil,
+		nil}
+
+	// reopen the block tree and its longest chain, if any
+	keys, err := storage.Keys(treePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		hash := key[len(treePrefix):]
+		b, err := bc.loadBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		bc.blocks[string(hash)] = b
+	}
+	for _, b := range bc.blocks {
+		b.prev = bc.blocks[string(b.prevHash)]
+	}
+	hash, err := storage.Get(tipKey)
+	if _, ok := err.(*smt.InvalidKeyError); ok {
+		return bc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bc.blocks[string(hash)] == nil {
+		return nil, errors.New("the last block is not in the stored block tree")
+	}
+	bc.last, bc.length = bc.blocks[string(hash)], int(bc.blocks[string(hash)].height)+1
+	bc.stateTree = smt.ImportSparseMerkleTree(stateStore, params.Hash(), bc.last.postStateRoot())
+	return bc, nil
 }
 
-// Append appends a block to the blockchain or returns a fraud proof if the block is not constructed correctly.
+// Append adds a block to the block tree or returns a fraud proof if the block is not constructed correctly. The block
+// must be a first block or the child of a block of the tree (see SetParent). If the block makes a chain longer than the
+// current one, the blockchain reorganizes onto it. Blocks rejected by an admission rule are returned an error, and are
+// not marked invalid since they may be admitted later. The block is checked with the state machine of the chain,
+// whatever state machine it was built with, and adopts it along with the parameters of the chain once it is added.
 func (bc *Blockchain) Append(b *Block) (*FraudProof, error) {
-	fp, err := b.CheckBlock(bc.stateTree)
+	if !bytes.Equal(b.params.Digest(), bc.params.Digest()) {
+		return nil, errors.New("the block does not use the parameters of the chain")
+	}
+	hash := b.Header().Hash()
+	if bc.blocks[string(hash)] != nil {
+		return nil, errors.New("the block is already in the blockchain")
+	}
+	invalid, err := bc.IsInvalid(hash)
+	if err != nil {
+		return nil, err
+	}
+	if invalid {
+		return nil, errors.New("the block is invalid")
+	}
+	var parent *Block
+	if len(b.prevHash) != 0 {
+		parent = bc.blocks[string(b.prevHash)]
+		if parent == nil {
+			invalid, err := bc.IsInvalid(b.prevHash)
+			if err != nil {
+				return nil, err
+			}
+			if invalid {
+				return nil, errors.New("the parent block is invalid")
+			}
+			return nil, errors.New("the parent block is unknown")
+		}
+	}
+	if (parent == nil && b.height != 0) || (parent != nil && b.height != parent.height+1) {
+		return nil, errors.New("the height of the block does not follow the one of its parent")
+	}
+	for _, rule := range bc.rules {
+		err := rule.Admit(b.Header())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. check a copy of the block, bound to the chain, on a view of the state after its parent, so that a rejected
+	// block leaves both the block and the state untouched
+	bound := *b
+	bound.params, bound.stateMachine = bc.params, bc.stateMachine
+	view := newStateView(prefixStore{bc.storage, statePrefix})
+	var parentHeader *BlockHeader
+	if parent != nil {
+		parentHeader = parent.Header()
+	}
+	stateTree := smt.ImportSparseMerkleTree(view, bc.params.Hash(), bc.stateRootAfter(parent))
+	fp, err := bound.CheckBlock(stateTree, parentHeader)
 	if err != nil {
 		return nil, err
 	}
 	if fp != nil {
+		err = bc.storage.Put(append(append([]byte{}, invalidPrefix...), hash...), []byte{1})
+		if err != nil {
+			return nil, err
+		}
+		bc.emit(InvalidBlockEvent{fp, [][]byte{hash}, bc.last})
 		return fp, nil
 	}
 
-	if bc.length == 0 {
-		bc.last = b
-	} else {
-		b.prev = bc.last
-		bc.last = b
+	// 2. add the block and its state to the block tree, and reorganize the blockchain if it ends the longest chain
+	b.prev, b.params, b.stateMachine = parent, bc.params, bc.stateMachine
+	err = view.commit()
+	if err != nil {
+		return nil, err
+	}
+	err = bc.storeBlock(b)
+	if err != nil {
+		return nil, err
+	}
+	bc.blocks[string(hash)] = b
+	err = bc.storage.Put(append(append([]byte{}, treePrefix...), hash...), []byte{1})
+	if err != nil {
+		return nil, err
+	}
+	if int(b.height) >= bc.length {
+		return nil, bc.reorganize(b)
 	}
-	bc.length++
 	return nil, nil
 }
+
+// SubmitFraudProof receives a fraud proof about a block of the block tree, for example from a peer. If the fraud proof
+// checks against the header of the block, the block and its descendants are marked invalid and pruned, the state is
+// rolled back if the longest chain is pruned, and an InvalidBlockEvent is emitted.
+func (bc *Blockchain) SubmitFraudProof(blockHash []byte, fp FraudProof) error {
+	b, err := bc.BlockByHash(blockHash)
+	if err != nil {
+		return err
+	}
+	if !VerifyFraudProof(b.Header(), fp, bc.params, bc.stateMachine) {
+		return errors.New("the fraud proof does not check against the block")
+	}
+	pruned, err := bc.invalidate(b)
+	if err != nil {
+		return err
+	}
+	bc.emit(InvalidBlockEvent{&fp, pruned, bc.last})
+	return nil
+}
+
+// OnInvalidBlock registers a function called on every invalid block event, whether the fraud proof is generated when
+// a block is appended or submitted afterwards.
+func (bc *Blockchain) OnInvalidBlock(f func(InvalidBlockEvent)) {
+	bc.listeners = append(bc.listeners, f)
+}
+
+// emit calls the registered functions with the given event.
+func (bc *Blockchain) emit(event InvalidBlockEvent) {
+	for _, f := range bc.listeners {
+		f(event)
+	}
+}
+
+// AddAdmissionRule adds a rule that blocks must pass before being checked, such as a sampler; light nodes holding only
+// headers add their rules to a HeaderChain instead.
+func (bc *Blockchain) AddAdmissionRule(rule AdmissionRule) {
+	bc.rules = append(bc.rules, rule)
+}
+
+// GetShare returns a share of the extended data square of a block of the block tree, and its Merkle proof against the
+// data root of the block; it serves data availability samplers.
+func (bc *Blockchain) GetShare(blockHash []byte, row int, col int) ([]byte, [][]byte, error) {
+	b, err := bc.BlockByHash(blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if row < 0 || row >= b.dataSquare.width || col < 0 || col >= b.dataSquare.width {
+		return nil, nil, errors.New("no share at these coordinates")
+	}
+	proof, err := b.dataSquare.proveShare(b.params, row, col)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof[0], proof, nil
+}
+
+// BlockByHash returns the block of the block tree whose header has the given hash, such as the block accused by a fraud
+// proof.
+func (bc *Blockchain) BlockByHash(hash []byte) (*Block, error) {
+	b := bc.blocks[string(hash)]
+	if b == nil {
+		return nil, errors.New("unknown block")
+	}
+	return b, nil
+}
+
+// BlockByHeight returns the block of the longest chain at the given height.
+func (bc *Blockchain) BlockByHeight(height uint64) (*Block, error) {
+	if height >= uint64(bc.length) {
+		return nil, errors.New("no block at this height")
+	}
+	b := bc.last
+	for b.height > height {
+		b = b.prev
+	}
+	return b, nil
+}
+
+// IsInvalid returns whether the block with the given header hash was shown invalid by a fraud proof.
+func (bc *Blockchain) IsInvalid(hash []byte) (bool, error) {
+	_, err := bc.storage.Get(append(append([]byte{}, invalidPrefix...), hash...))
+	if _, ok := err.(*smt.InvalidKeyError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Close closes the storage of the blockchain.
+func (bc *Blockchain) Close() error {
+	return bc.storage.Close()
+}
+
+// invalidate marks a block of the block tree as invalid, and prunes it from the tree along with its descendants, whose
+// headers and bodies are deleted from the storage; it returns the hashes of the pruned blocks, starting with the given
+// block. If the longest chain is pruned, the
+// blockchain reorganizes onto the longest remaining one.
+func (bc *Blockchain) invalidate(b *Block) ([][]byte, error) {
+	pruned := [][]byte{b.Header().Hash()}
+	lastPruned := false
+	for hash, c := range bc.blocks {
+		if !isAncestor(b, c) {
+			continue
+		}
+		err := bc.storage.Put(append(append([]byte{}, invalidPrefix...), hash...), []byte{1})
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range [][]byte{treePrefix, headerPrefix, bodyPrefix} {
+			err = bc.storage.Del(append(append([]byte{}, prefix...), hash...))
+			if _, ok := err.(*smt.InvalidKeyError); err != nil && !ok {
+				return nil, err
+			}
+		}
+		delete(bc.blocks, hash)
+		if c != b {
+			pruned = append(pruned, []byte(hash))
+		}
+		lastPruned = lastPruned || c == bc.last
+	}
+	if lastPruned {
+		return pruned, bc.reorganize(bc.longestChain())
+	}
+	return pruned, nil
+}
+
+// reorganize makes the given block the last block of the blockchain (or empties it if the block is nil). Every block
+// of the tree is checked when it is added, and the state after it is kept in the storage; rolling the state back to
+// the common ancestor of the old and new last blocks and applying the new branch on top of it thus amounts to moving
+// the state root.
+func (bc *Blockchain) reorganize(b *Block) error {
+	bc.last, bc.length = b, 0
+	if b != nil {
+		bc.length = int(b.height) + 1
+	}
+	bc.stateTree.SetRoot(bc.stateRootAfter(b))
+	if b == nil {
+		return bc.storage.Del(tipKey)
+	}
+	return bc.storage.Put(tipKey, b.Header().Hash())
+}
+
+// longestChain returns the last block of the longest chain of the block tree, or nil if the tree is empty. Ties are
+// broken by the smallest header hash.
+func (bc *Blockchain) longestChain() *Block {
+	var last *Block
+	var lastHash string
+	for hash, b := range bc.blocks {
+		if last == nil || b.height > last.height || (b.height == last.height && hash < lastHash) {
+			last, lastHash = b, hash
+		}
+	}
+	return last
+}
+
+// stateRootAfter returns the state root after the given block, or the root of the empty state if the block is nil.
+func (bc *Blockchain) stateRootAfter(b *Block) []byte {
+	if b == nil {
+		return bc.params.emptyStateRoot()
+	}
+	return b.postStateRoot()
+}
+
+// isAncestor returns whether the block a is the block b or one of its ancestors.
+func isAncestor(a *Block, b *Block) bool {
+	for ; b != nil; b = b.prev {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// storeBlock persists a block.
+func (bc *Blockchain) storeBlock(b *Block) error {
+	header := b.Header()
+	hash := header.Hash()
+	buff, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = bc.storage.Put(append(append([]byte{}, headerPrefix...), hash...), buff)
+	if err != nil {
+		return err
+	}
+	buff, err = proto.Marshal(b.bodyToProto())
+	if err != nil {
+		return err
+	}
+	return bc.storage.Put(append(append([]byte{}, bodyPrefix...), hash...), buff)
+}
+
+// loadBlock loads the block with the given hash from the storage, and checks it against its header.
+func (bc *Blockchain) loadBlock(hash []byte) (*Block, error) {
+	// 1. load the header and the body of the block
+	buff, err := bc.storage.Get(append(append([]byte{}, headerPrefix...), hash...))
+	if err != nil {
+		return nil, err
+	}
+	header := &BlockHeader{}
+	err = header.UnmarshalBinary(buff)
+	if err != nil {
+		return nil, err
+	}
+	buff, err = bc.storage.Get(append(append([]byte{}, bodyPrefix...), hash...))
+	if err != nil {
+		return nil, err
+	}
+	body := &pb.BlockBody{}
+	err = proto.Unmarshal(buff, body)
+	if err != nil {
+		return nil, err
+	}
+	t := make([]Transaction, len(body.Transactions))
+	for i := 0; i < len(t); i++ {
+		tmp, err := TransactionFromProto(body.Transactions[i])
+		if err != nil {
+			return nil, err
+		}
+		t[i] = *tmp
+	}
+
+	// 2. rebuild the data square and check the block against its header
+	if !bytes.Equal(header.Hash(), hash) {
+		return nil, errors.New("the stored block does not match its header")
+	}
+	return rebuildBlock(header, t, append([][]byte{body.PrevStateRoot}, body.InterStateRoots...), bc.params,
+		bc.stateMachine)
+}
@@ -0,0 +1,411 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/NebulousLabs/merkletree"
+	"github.com/klauspost/reedsolomon"
+	"math/bits"
+)
+
+// shareHeaderSize is the size of the header of a share, which holds the size of its chunk.
+const shareHeaderSize int = 4
+
+// maxSquareWidth is the maximum width of an extended data square, as Reed-Solomon codes over GF(2^8) have at most 256
+// shards.
+const maxSquareWidth int = 256
+
+// MaxChunks is the maximum number of chunks of a block: its original data square is at most 128×128 chunks. The data of
+// a block is thus at most MaxChunks times the chunk size of the chain, minus the chunk headers; chains needing larger
+// blocks should use larger chunks.
+const MaxChunks int = (maxSquareWidth / 2) * (maxSquareWidth / 2)
+
+// dataSquare is the extended data square of a block. Its chunks are arranged row by row in a k×k matrix, extended to
+// 2k×2k with Reed-Solomon codes, and committed through the Merkle roots of its rows and columns; the data root of the
+// block is the Merkle root of the row roots followed by the column roots. If the chain uses namespaces, rows and columns
+// are committed through namespaced Merkle trees instead, in which padding and parity shares have the largest namespace.
+type dataSquare struct {
+	width    int      // width of the extended square (2k)
+	shares   [][]byte // shares of the extended square, row by row
+	rowRoots [][]byte
+	colRoots [][]byte
+}
+
+// squareWidth returns the width k of the smallest square holding n chunks; it is a power of two. It stops at
+// maxSquareWidth, since no extended data square is wide enough to hold more chunks.
+func squareWidth(n uint64) int {
+	k := 1
+	for uint64(k)*uint64(k) < n && k < maxSquareWidth {
+		k *= 2
+	}
+	return k
+}
+
+// shareSize returns the size of a share of the data square.
+func (p *ChainParams) shareSize() int {
+	return 2*p.NamespaceSize + shareHeaderSize + p.ChunkSize
+}
+
+// makeShare converts a chunk into a share: the range of namespaces of the chunk if the chain uses namespaces, then the
+// size of the chunk as a little-endian uint32, followed by the chunk padded with zeros. It returns nil if the chunk
+// does not fit in a share.
+func makeShare(params *ChainParams, namespaces []byte, chunk []byte) []byte {
+	if len(chunk) > params.ChunkSize || len(namespaces) != 2*params.NamespaceSize {
+		return nil
+	}
+	share := make([]byte, params.shareSize())
+	copy(share, namespaces)
+	binary.LittleEndian.PutUint32(share[len(namespaces):], uint32(len(chunk)))
+	copy(share[len(namespaces)+shareHeaderSize:], chunk)
+	return share
+}
+
+// shareChunk returns the chunk held by a share, or nil if the share is malformed.
+func shareChunk(params *ChainParams, share []byte) []byte {
+	if len(share) != params.shareSize() {
+		return nil
+	}
+	share = share[2*params.NamespaceSize:]
+	size := binary.LittleEndian.Uint32(share)
+	if uint64(size) > uint64(params.ChunkSize) {
+		return nil
+	}
+	return share[shareHeaderSize : shareHeaderSize+int(size)]
+}
+
+// newDataSquare arranges the chunks in a square, which is padded with empty shares, and extends it. If the chain uses
+// namespaces, the range of namespaces of every chunk must be given.
+func newDataSquare(params *ChainParams, chunks [][]byte, namespaces [][]byte) (*dataSquare, error) {
+	// 1. arrange the chunks in the original square
+	k := squareWidth(uint64(len(chunks)))
+	if 2*k > maxSquareWidth {
+		return nil, errors.New("the block data is larger than MaxChunks chunks; use a larger chunk size")
+	}
+	if params.NamespaceSize > 0 && len(namespaces) != len(chunks) {
+		return nil, errors.New("missing ranges of namespaces of the chunks")
+	}
+	width := 2 * k
+	padding := append(params.maxNamespace(), params.maxNamespace()...)
+	shares := make([][]byte, width*width)
+	for i := 0; i < len(shares); i++ {
+		shares[i] = makeShare(params, padding, nil)
+	}
+	for i := 0; i < len(chunks); i++ {
+		var share []byte
+		if params.NamespaceSize > 0 {
+			share = makeShare(params, namespaces[i], chunks[i])
+		} else {
+			share = makeShare(params, nil, chunks[i])
+		}
+		if share == nil {
+			return nil, errors.New("chunk larger than the chunk size")
+		}
+		shares[(i/k)*width+i%k] = share
+	}
+
+	// 2. extend the rows of the original square, then every column
+	enc, err := reedsolomon.New(k, k)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < k; i++ {
+		err = enc.Encode(shares[i*width : (i+1)*width])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for j := 0; j < width; j++ {
+		column := make([][]byte, width)
+		for i := 0; i < width; i++ {
+			column[i] = shares[i*width+j]
+		}
+		err = enc.Encode(column)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. commit to the rows and columns
+	return commitSquare(params, shares, width), nil
+}
+
+// commitSquare returns the extended data square of the given width with the given shares, given row by row, and commits
+// to its rows and columns.
+func commitSquare(params *ChainParams, shares [][]byte, width int) *dataSquare {
+	s := &dataSquare{width, shares, make([][]byte, width), make([][]byte, width)}
+	for i := 0; i < width; i++ {
+		s.rowRoots[i] = axisRoot(params, i, s.row(i))
+		s.colRoots[i] = axisRoot(params, width+i, s.col(i))
+	}
+	return s
+}
+
+// row returns the shares of the i-th row.
+func (s *dataSquare) row(i int) [][]byte {
+	return s.shares[i*s.width : (i+1)*s.width]
+}
+
+// col returns the shares of the j-th column.
+func (s *dataSquare) col(j int) [][]byte {
+	column := make([][]byte, s.width)
+	for i := 0; i < s.width; i++ {
+		column[i] = s.shares[i*s.width+j]
+	}
+	return column
+}
+
+// roots returns the row roots followed by the column roots; the index of a row or column in this list is its axis.
+func (s *dataSquare) roots() [][]byte {
+	return append(append([][]byte{}, s.rowRoots...), s.colRoots...)
+}
+
+// axisShares returns the shares of a row or column, given its axis.
+func (s *dataSquare) axisShares(axis int) [][]byte {
+	if axis < s.width {
+		return s.row(axis)
+	}
+	return s.col(axis - s.width)
+}
+
+// dataRoot returns the Merkle root of the row roots followed by the column roots.
+func (s *dataSquare) dataRoot(params *ChainParams) []byte {
+	return merkleRoot(params, s.roots())
+}
+
+// proveShare returns the Merkle proof of the share at the given position of a row or column against the data root: the
+// proof of the share against the root of the row or column, followed by the proof of that root against the data root.
+// The share at row i and column j is at position j of axis i.
+func (s *dataSquare) proveShare(params *ChainParams, axis int, position int) ([][]byte, error) {
+	shareProof, err := axisProof(params, axis, s.axisShares(axis), position)
+	if err != nil {
+		return nil, err
+	}
+	rootProof, err := merkleProof(params, s.roots(), axis)
+	if err != nil {
+		return nil, err
+	}
+	return append(shareProof, rootProof...), nil
+}
+
+// verifyShareProof verifies a Merkle proof generated by proveShare, for the share at the given position of a row or
+// column of an extended data square of the given width.
+func verifyShareProof(params *ChainParams, dataRoot []byte, share []byte, proof [][]byte, axis int, position int,
+	width int) bool {
+	n := proofSize(width)
+	if len(proof) != n+proofSize(2*width) || !bytes.Equal(proof[0], share) {
+		return false
+	}
+	return verifyAxisProof(params, proof[n], proof[:n], axis, position, width) &&
+		verifyRootProof(params, dataRoot, proof[n:], axis, width)
+}
+
+// verifyRootProof verifies the Merkle proof of the root of a row or column against the data root of an extended data
+// square of the given width; the proof starts with the root itself.
+func verifyRootProof(params *ChainParams, dataRoot []byte, proof [][]byte, axis int, width int) bool {
+	return merkletree.VerifyProof(params.Hash(), dataRoot, proof, uint64(axis), uint64(2*width))
+}
+
+// axisLeaf returns the leaf committing to the share at the given position of a row or column of an extended data square
+// of the given width. If the chain uses namespaces, shares of the original square are leaves starting with their range
+// of namespaces, and parity shares are prefixed with the range of the largest namespace.
+func axisLeaf(params *ChainParams, share []byte, axis int, position int, width int) []byte {
+	row, col := axis, position
+	if axis >= width {
+		row, col = position, axis-width
+	}
+	if params.NamespaceSize == 0 || (row < width/2 && col < width/2) {
+		return share
+	}
+	return append(append(params.maxNamespace(), params.maxNamespace()...), share...)
+}
+
+// axisRoot returns the root of a row or column given its axis and its shares. If the chain uses namespaces, it is the
+// root of a namespaced Merkle tree, or nil if the shares are not sorted by namespace.
+func axisRoot(params *ChainParams, axis int, shares [][]byte) []byte {
+	if params.NamespaceSize == 0 {
+		return merkleRoot(params, shares)
+	}
+	leaves := make([][]byte, len(shares))
+	for j := 0; j < len(shares); j++ {
+		leaves[j] = nmtLeafHash(params, axisLeaf(params, shares[j], axis, j, len(shares)))
+		if leaves[j] == nil {
+			return nil
+		}
+	}
+	return nmtRoot(params, leaves, 0, len(leaves))
+}
+
+// checkAxisRoot returns whether a root of a row or column is well formed: a hash, preceded by a range of namespaces if
+// the chain uses namespaces. Rows and columns whose shares are not sorted by namespace have a nil root.
+func checkAxisRoot(params *ChainParams, root []byte) bool {
+	if params.NamespaceSize == 0 {
+		return len(root) == params.Hash().Size()
+	}
+	return len(root) == 2*params.NamespaceSize+params.Hash().Size() &&
+		bytes.Compare(nmtMin(params, root), nmtMax(params, root)) <= 0
+}
+
+// axisProof returns the proof of the share at the given position of a row or column against its root, starting with
+// the share itself.
+func axisProof(params *ChainParams, axis int, shares [][]byte, position int) ([][]byte, error) {
+	if params.NamespaceSize == 0 {
+		return merkleProof(params, shares, position)
+	}
+	tree, err := axisTree(params, axis, shares)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{shares[position]}, tree.proveRange(position, position+1).nodes...), nil
+}
+
+// axisTree returns the namespaced Merkle tree of a row or column given its axis and its shares; the hashes of malformed
+// leaves are nil.
+func axisTree(params *ChainParams, axis int, shares [][]byte) (*NamespacedMerkleTree, error) {
+	tree, err := NewNamespacedMerkleTree(params)
+	if err != nil {
+		return nil, err
+	}
+	for j := 0; j < len(shares); j++ {
+		tree.leaves = append(tree.leaves, nmtLeafHash(params, axisLeaf(params, shares[j], axis, j, len(shares))))
+	}
+	return tree, nil
+}
+
+// verifyAxisProof verifies a proof generated by axisProof against the root of a row or column of an extended data
+// square of the given width.
+func verifyAxisProof(params *ChainParams, root []byte, proof [][]byte, axis int, position int, width int) bool {
+	if params.NamespaceSize == 0 {
+		return merkletree.VerifyProof(params.Hash(), root, proof, uint64(position), uint64(width))
+	}
+	leaf := axisLeaf(params, proof[0], axis, position, width)
+	check := func([]byte, bool) bool { return true }
+	computed := verifyRange(params, [][]byte{leaf}, &NamespaceProof{position, position + 1, width, proof[1:]}, check)
+	return computed != nil && bytes.Equal(computed, root)
+}
+
+// recoverAxis recovers the shares of a row or column from any half of them; the missing shares are nil.
+func recoverAxis(shares [][]byte) ([][]byte, error) {
+	k := len(shares) / 2
+	enc, err := reedsolomon.New(k, k)
+	if err != nil {
+		return nil, err
+	}
+	recovered := append([][]byte{}, shares...)
+	err = enc.Reconstruct(recovered)
+	if err != nil {
+		return nil, err
+	}
+	return recovered, nil
+}
+
+// recoverSquare recovers in place the missing shares of an extended data square of the given width, given row by row
+// with nil for the missing shares. It recovers every row and column holding at least half of its shares, until no share
+// is missing or no more row or column can be recovered.
+func recoverSquare(params *ChainParams, shares [][]byte, width int) error {
+	for i := 0; i < len(shares); i++ {
+		if shares[i] != nil && len(shares[i]) != params.shareSize() {
+			return errors.New("share of the wrong size")
+		}
+	}
+	k := width / 2
+	enc, err := reedsolomon.New(k, k)
+	if err != nil {
+		return err
+	}
+	index := func(axis int, position int) int {
+		if axis < width {
+			return axis*width + position
+		}
+		return position*width + axis - width
+	}
+
+	for {
+		missing, recovered := 0, false
+		for axis := 0; axis < 2*width; axis++ {
+			axisShares := make([][]byte, width)
+			present := 0
+			for j := 0; j < width; j++ {
+				axisShares[j] = shares[index(axis, j)]
+				if axisShares[j] != nil {
+					present++
+				}
+			}
+			if present == width {
+				continue
+			}
+			if present < k {
+				missing += width - present
+				continue
+			}
+			err = enc.Reconstruct(axisShares)
+			if err != nil {
+				return err
+			}
+			for j := 0; j < width; j++ {
+				shares[index(axis, j)] = axisShares[j]
+			}
+			recovered = true
+		}
+		if missing == 0 {
+			return nil
+		}
+		if !recovered {
+			return errors.New("not enough shares to recover the data square")
+		}
+	}
+}
+
+// findBadAxis returns the axis of a row or column whose shares are not the Reed-Solomon extension of its first half,
+// or whose root is malformed or does not commit to that extension; it returns -1 if the square is correctly erasure
+// coded.
+func (s *dataSquare) findBadAxis(params *ChainParams) (int, error) {
+	k := s.width / 2
+	enc, err := reedsolomon.New(k, k)
+	if err != nil {
+		return 0, err
+	}
+	roots := s.roots()
+	for axis := 0; axis < len(roots); axis++ {
+		shares := append([][]byte{}, s.axisShares(axis)[:k]...)
+		for j := 0; j < k; j++ {
+			shares = append(shares, make([]byte, params.shareSize()))
+		}
+		err = enc.Encode(shares)
+		if err != nil {
+			return 0, err
+		}
+		if !checkAxisRoot(params, roots[axis]) || !bytes.Equal(axisRoot(params, axis, shares), roots[axis]) {
+			return axis, nil
+		}
+	}
+	return -1, nil
+}
+
+// proofSize returns the size of a Merkle proof, including its leaf, in a tree with n leaves; n must be a power of two.
+func proofSize(n int) int {
+	return 1 + bits.TrailingZeros(uint(n))
+}
+
+// merkleRoot returns the Merkle root of the given leaves.
+func merkleRoot(params *ChainParams, leaves [][]byte) []byte {
+	tree := merkletree.New(params.Hash())
+	for i := 0; i < len(leaves); i++ {
+		tree.Push(leaves[i])
+	}
+	return tree.Root()
+}
+
+// merkleProof returns the Merkle proof of the i-th leaf, starting with the leaf itself.
+func merkleProof(params *ChainParams, leaves [][]byte, i int) ([][]byte, error) {
+	tree := merkletree.New(params.Hash())
+	err := tree.SetIndex(uint64(i))
+	if err != nil {
+		return nil, err
+	}
+	for j := 0; j < len(leaves); j++ {
+		tree.Push(leaves[j])
+	}
+	_, proof, _, _ := tree.Prove()
+	return proof, nil
+}
@@ -2,21 +2,278 @@
 package fraudproofs
 
 import (
+	"encoding/binary"
+	"errors"
 	"github.com/lazyledger/smt"
 )
 
-// FraudProof is a fraud proof.
+// FraudProofVersion is the version of the fraud proof wire format.
+const FraudProofVersion byte = 5
+
+// FraudProofKind is the kind of fraud shown by a fraud proof.
+type FraudProofKind byte
+
+const (
+	// StateTransitionFraud shows that a window of transactions does not lead to the committed state root.
+	StateTransitionFraud FraudProofKind = iota
+	// InvalidTransactionFraud shows that a committed chunk decodes to a malformed or invalid transaction.
+	InvalidTransactionFraud
+	// BadEncodingFraud shows that the size or the header of a committed chunk disagrees with the serialized data.
+	BadEncodingFraud
+	// MissingStateRootFraud shows that an intermediate state root is missing from the committed data.
+	MissingStateRootFraud
+	// ExtraStateRootFraud shows that the committed data holds more intermediate state roots than windows of
+	// transactions.
+	ExtraStateRootFraud
+	// BadErasureCodingFraud shows that a row or column of the extended data square is not correctly erasure coded.
+	BadErasureCodingFraud
+	// HeaderStateRootFraud shows that the last committed state root differs from the state root of the block header.
+	HeaderStateRootFraud
+	// ParentStateRootFraud shows that the first committed state root, on top of which the block is applied, differs
+	// from the state root of the header of its parent (or from the empty state for a first block).
+	ParentStateRootFraud
+	// MislabelledShareFraud shows that the range of namespaces of a committed share differs from the one of the records
+	// its chunk holds data of.
+	MislabelledShareFraud
+	// UnsortedNamespaceFraud shows that the committed transactions are not sorted by namespace.
+	UnsortedNamespaceFraud
+)
+
+// FraudProof is a fraud proof. Fields that are not used by its kind are empty.
 type FraudProof struct {
 	// data structure
+	kind FraudProofKind
+	blockHash []byte // hash of the header of the accused block
 	writeKeys [][]byte
 	oldData [][]byte
 	readKeys [][]byte
 	readData [][]byte
 	proofState []smt.SparseCompactMerkleProof
-	chunks [][]byte
+	proofReadState []smt.SparseCompactMerkleProof
+	chunks [][]byte // chunks, or shares of the accused row or column for bad erasure coding fraud proofs
 	proofChunks [][][]byte
 
 	// implementation specific
 	chunksIndexes []uint64
-	numOfLeaves uint64
+	numOfLeaves uint64 // number of chunks of the block, as committed by its header
+	recordIndex uint64 // index of the first proven record among the records starting in the first chunk
+	axisIndex uint64 // axis of the accused row or column of the data square
+	parentHeader []byte // canonical encoding of the header of the parent of the accused block
+}
+
+// Kind returns the kind of fraud shown by the fraud proof.
+func (fp *FraudProof) Kind() FraudProofKind {
+	return fp.kind
+}
+
+// BlockHash returns the hash of the header of the block accused by the fraud proof.
+func (fp *FraudProof) BlockHash() []byte {
+	return fp.blockHash
+}
+
+// MarshalBinary encodes the fraud proof into its canonical wire format.
+// It starts with the version and the kind of the fraud proof, and every variable-length field is prefixed by its
+// length as a little-endian uint32.
+func (fp *FraudProof) MarshalBinary() ([]byte, error) {
+	buff := []byte{FraudProofVersion, byte(fp.kind)}
+	buff = appendUint32(buff, len(fp.blockHash))
+	buff = append(buff, fp.blockHash...)
+	buff = appendBytesList(buff, fp.writeKeys)
+	buff = appendBytesList(buff, fp.oldData)
+	buff = appendBytesList(buff, fp.readKeys)
+	buff = appendBytesList(buff, fp.readData)
+
+	buff = appendUint32(buff, len(fp.proofState))
+	for i := 0; i < len(fp.proofState); i++ {
+		buff = appendBytesList(buff, fp.proofState[i])
+	}
+
+	buff = appendUint32(buff, len(fp.proofReadState))
+	for i := 0; i < len(fp.proofReadState); i++ {
+		buff = appendBytesList(buff, fp.proofReadState[i])
+	}
+
+	buff = appendBytesList(buff, fp.chunks)
+
+	buff = appendUint32(buff, len(fp.proofChunks))
+	for i := 0; i < len(fp.proofChunks); i++ {
+		buff = appendBytesList(buff, fp.proofChunks[i])
+	}
+
+	buff = appendUint32(buff, len(fp.chunksIndexes))
+	for i := 0; i < len(fp.chunksIndexes); i++ {
+		buff = appendUint64(buff, fp.chunksIndexes[i])
+	}
+	buff = appendUint64(buff, fp.numOfLeaves)
+	buff = appendUint64(buff, fp.recordIndex)
+	buff = appendUint64(buff, fp.axisIndex)
+	buff = appendUint32(buff, len(fp.parentHeader))
+	buff = append(buff, fp.parentHeader...)
+
+	return buff, nil
+}
+
+// UnmarshalBinary decodes a fraud proof from its wire format. Malformed inputs are rejected with an error.
+func (fp *FraudProof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty fraud proof")
+	}
+	if data[0] != FraudProofVersion {
+		return errors.New("unsupported fraud proof version")
+	}
+	if len(data) < 2 || FraudProofKind(data[1]) > UnsortedNamespaceFraud {
+		return errors.New("unsupported fraud proof kind")
+	}
+	kind := FraudProofKind(data[1])
+	d := &decoder{data[2:], nil}
+
+	blockHash := d.bytes()
+	writeKeys := d.bytesList()
+	oldData := d.bytesList()
+	readKeys := d.bytesList()
+	readData := d.bytesList()
+
+	proofState := make([]smt.SparseCompactMerkleProof, d.count(4))
+	for i := 0; i < len(proofState); i++ {
+		proofState[i] = d.bytesList()
+	}
+
+	proofReadState := make([]smt.SparseCompactMerkleProof, d.count(4))
+	for i := 0; i < len(proofReadState); i++ {
+		proofReadState[i] = d.bytesList()
+	}
+
+	chunks := d.bytesList()
+
+	proofChunks := make([][][]byte, d.count(4))
+	for i := 0; i < len(proofChunks); i++ {
+		proofChunks[i] = d.bytesList()
+	}
+
+	chunksIndexes := make([]uint64, d.count(8))
+	for i := 0; i < len(chunksIndexes); i++ {
+		chunksIndexes[i] = d.uint64()
+	}
+	numOfLeaves := d.uint64()
+	recordIndex := d.uint64()
+	axisIndex := d.uint64()
+	parentHeader := d.bytes()
+
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buff) != 0 {
+		return errors.New("trailing bytes after fraud proof")
+	}
+	if len(writeKeys) != len(oldData) || len(writeKeys) != len(proofState) ||
+		len(readKeys) != len(readData) || len(readKeys) != len(proofReadState) {
+		return errors.New("number of keys does not match the number of data or proofs")
+	}
+	if len(chunks) != len(proofChunks) || len(chunks) != len(chunksIndexes) {
+		return errors.New("number of chunks does not match the number of chunks proofs or indexes")
+	}
+
+	*fp = FraudProof{
+		kind,
+		blockHash,
+		writeKeys,
+		oldData,
+		readKeys,
+		readData,
+		proofState,
+		proofReadState,
+		chunks,
+		proofChunks,
+		chunksIndexes,
+		numOfLeaves,
+		recordIndex,
+		axisIndex,
+		parentHeader}
+	return nil
+}
+
+// appendUint32 appends a little-endian uint32 to the buffer.
+func appendUint32(buff []byte, n int) []byte {
+	tmp := make([]byte, 4)
+	binary.LittleEndian.PutUint32(tmp, uint32(n))
+	return append(buff, tmp...)
+}
+
+// appendUint64 appends a little-endian uint64 to the buffer.
+func appendUint64(buff []byte, n uint64) []byte {
+	tmp := make([]byte, 8)
+	binary.LittleEndian.PutUint64(tmp, n)
+	return append(buff, tmp...)
+}
+
+// appendBytesList appends a length-prefixed list of length-prefixed byte arrays to the buffer.
+func appendBytesList(buff []byte, list [][]byte) []byte {
+	buff = appendUint32(buff, len(list))
+	for i := 0; i < len(list); i++ {
+		buff = appendUint32(buff, len(list[i]))
+		buff = append(buff, list[i]...)
+	}
+	return buff
+}
+
+// decoder reads fields from a wire format buffer; the first error is sticky and stops any further read.
+type decoder struct {
+	buff []byte
+	err  error
+}
+
+// next consumes n bytes from the buffer.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buff) < n {
+		d.err = errors.New("truncated input")
+		return nil
+	}
+	var ret []byte
+	ret, d.buff = d.buff[:n], d.buff[n:]
+	return ret
+}
+
+// uint64 reads a little-endian uint64.
+func (d *decoder) uint64() uint64 {
+	tmp := d.next(8)
+	if tmp == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(tmp)
+}
+
+// count reads the number of elements of a list whose elements take at least minSize bytes each; it rejects
+// counts that cannot fit in the remaining buffer so that hostile inputs cannot trigger huge allocations.
+func (d *decoder) count(minSize int) int {
+	tmp := d.next(4)
+	if tmp == nil {
+		return 0
+	}
+	n := uint64(binary.LittleEndian.Uint32(tmp))
+	if n*uint64(minSize) > uint64(len(d.buff)) {
+		d.err = errors.New("truncated input")
+		return 0
+	}
+	return int(n)
+}
+
+// bytes reads a length-prefixed byte array.
+func (d *decoder) bytes() []byte {
+	tmp := d.next(4)
+	if tmp == nil {
+		return nil
+	}
+	return append([]byte{}, d.next(int(binary.LittleEndian.Uint32(tmp)))...)
+}
+
+// bytesList reads a length-prefixed list of length-prefixed byte arrays.
+func (d *decoder) bytesList() [][]byte {
+	list := make([][]byte, d.count(4))
+	for i := 0; i < len(list); i++ {
+		list[i] = d.bytes()
+	}
+	return list
 }
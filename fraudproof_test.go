@@ -3,9 +3,13 @@ package fraudproofs
 import (
 	"bytes"
 	"crypto/sha512"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"github.com/NebulousLabs/merkletree"
+	"github.com/asonnino/fraudproofs-prototype/pb"
+	"github.com/klauspost/reedsolomon"
 	"github.com/lazyledger/smt"
+	"google.golang.org/protobuf/proto"
 	"math/rand"
 	"testing"
 	"time"
@@ -32,88 +36,1797 @@ func TestTransaction(test *testing.T) {
 	} else if bytes.Compare(t.Serialize(), buff) != 0 {
 		test.Error("transaction not serialized and deserialize correctly")
 	}
+
+	// deserialize malformed and invalid transactions
+	for i := 0; i < len(buff); i++ {
+		_, err = Deserialize(buff[:i])
+		if err != ErrTruncated {
+			test.Error("should return ErrTruncated")
+		}
+	}
+	_, err = Deserialize(append(buff[:len(buff):len(buff)], 0))
+	if err != ErrTrailingBytes {
+		test.Error("should return ErrTrailingBytes")
+	}
+	_, err = Deserialize(corruptTransaction(goodT).Serialize())
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// deserialize transactions with an unknown format and with a field larger than the transaction
+	unknownFormat := append([]byte{}, buff...)
+	_, n := binary.Uvarint(unknownFormat)
+	unknownFormat[n] = TransactionFormat + 1
+	_, err = Deserialize(unknownFormat)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	_, err = Deserialize([]byte{3, TransactionFormat, 200, 1})
+	if err != ErrFieldTooLarge {
+		test.Error("should return ErrFieldTooLarge")
+	}
+
+	// deserialize randomly corrupted transactions (should not panic)
+	for i := 0; i < 1000; i++ {
+		corrupted := append([]byte{}, buff...)
+		corrupted[rand.Intn(len(corrupted))] = byte(rand.Intn(256))
+		Deserialize(corrupted)
+	}
+
+	// serialize and deserialize a transaction larger than 64 KiB
+	writeKeys, newData, oldData, readKeys, readData, arbitrary := generateTransactionInput()
+	newData[0] = make([]byte, 100000)
+	largeT, err := NewTransaction(writeKeys, newData, oldData, readKeys, readData, arbitrary)
+	if err != nil {
+		test.Fatal(err)
+	}
+	buff = largeT.Serialize()
+	t, err = Deserialize(buff)
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(t.Serialize(), buff) != 0 || len(t.NewData()[0]) != 100000 {
+		test.Error("large transaction not serialized and deserialize correctly")
+	}
+
+	// serialize and deserialize a transaction reading more keys than it writes, with arbitrary data
+	asymmetricT := &generateAsymmetricTransactions(1)[0]
+	buff = asymmetricT.Serialize()
+	t, err = Deserialize(buff)
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(t.Serialize(), buff) != 0 || bytes.Compare(t.Arbitrary(), asymmetricT.Arbitrary()) != 0 {
+		test.Error("asymmetric transaction not serialized and deserialize correctly")
+	}
+
+	// convert to and from protocol buffers
+	t, err = TransactionFromProto(largeT.ToProto())
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(t.Serialize(), largeT.Serialize()) != 0 {
+		test.Error("transaction not converted to and from protocol buffers correctly")
+	}
+	_, err = TransactionFromProto(corruptTransaction(largeT).ToProto())
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// serialize and convert a transaction of a namespace
+	writeKeys, newData, oldData, readKeys, readData, arbitrary = generateTransactionInput()
+	namespacedT, err := NewNamespacedTransaction([]byte{1, 2}, writeKeys, newData, oldData, readKeys, readData, arbitrary)
+	if err != nil {
+		test.Fatal(err)
+	}
+	t, err = Deserialize(namespacedT.Serialize())
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(t.Namespace(), []byte{1, 2}) != 0 || bytes.Compare(t.Arbitrary(), arbitrary) != 0 {
+		test.Error("namespaced transaction not serialized and deserialize correctly")
+	}
+	t, err = TransactionFromProto(namespacedT.ToProto())
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(t.Serialize(), namespacedT.Serialize()) != 0 {
+		test.Error("namespaced transaction not converted to and from protocol buffers correctly")
+	}
+}
+
+
+func TestBlock(test *testing.T) {
+	// create bad block (corrupted transactions)
+	_, err :=  NewBlock(generateCorruptedBlockInput())
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// create good block
+	goodTransaction, stateTree, params, sm := generateBlockInput(1000000)
+	goodBlock, err :=  NewBlock(goodTransaction, stateTree, params, sm)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// check good block
+	_, err = goodBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// check a bad block (corrupted transactions)
+	badBlock := corruptBlockTransactions(goodBlock)
+	txFp, err := badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if txFp == nil || txFp.kind != InvalidTransactionFraud {
+		test.Error("should return an invalid transaction fraud proof")
+	} else if VerifyFraudProof(badBlock.Header(), *txFp, params, nil) != true {
+		test.Error("invalid transaction fraud proof does not check against the block header")
+	}
+
+	// verify invalid transaction fraud proof of a valid transaction
+	badFp, err := goodBlock.generateInvalidTransactionFraudProof(params.Step + 1)
+	if err != nil {
+		test.Error(err)
+	} else if goodBlock.VerifyFraudProof(*badFp) != false {
+		test.Error("invalid transaction fraud proof of a valid transaction should not check")
+	}
+
+	// check bad blocks (corrupted chunk header and chunk size)
+	for _, badBlock := range []*Block{corruptBlockChunkHeader(goodBlock), corruptBlockChunkSize(goodBlock)} {
+		encodingFp, err := badBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Error(err)
+		} else if encodingFp == nil || encodingFp.kind != BadEncodingFraud {
+			test.Error("should return a bad encoding fraud proof")
+		} else if VerifyFraudProof(badBlock.Header(), *encodingFp, params, nil) != true {
+			test.Error("bad encoding fraud proof does not check against the block header")
+		}
+	}
+
+	// verify bad encoding fraud proof of correctly formed chunks
+	badFp, err = goodBlock.generateBadEncodingFraudProof(3)
+	if err != nil {
+		test.Error(err)
+	} else if goodBlock.VerifyFraudProof(*badFp) != false {
+		test.Error("bad encoding fraud proof of correctly formed chunks should not check")
+	}
+
+	// check bad blocks (missing and extra intermediate state roots, and a number of transactions in the header off by
+	// whole windows, which leaves the size of the last window unchanged)
+	n := len(goodBlock.interStateRoots)
+	badBlocks := []*Block{
+		replaceBlockInterStates(goodBlock, goodBlock.interStateRoots[1:]),
+		replaceBlockInterStates(goodBlock, goodBlock.interStateRoots[:n-1]),
+		replaceBlockInterStates(goodBlock, append(goodBlock.interStateRoots[:n:n], goodBlock.stateRoot)),
+		replaceBlockNumTransactions(goodBlock, len(goodTransaction)+params.Step),
+		replaceBlockNumTransactions(goodBlock, len(goodTransaction)-params.Step),
+	}
+	kinds := []FraudProofKind{MissingStateRootFraud, MissingStateRootFraud, ExtraStateRootFraud, MissingStateRootFraud,
+		ExtraStateRootFraud}
+	for i := 0; i < len(badBlocks); i++ {
+		countFp, err := badBlocks[i].CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Error(err)
+		} else if countFp == nil || countFp.kind != kinds[i] {
+			test.Error("should return a missing or extra state root fraud proof")
+		} else if VerifyFraudProof(badBlocks[i].Header(), *countFp, params, nil) != true {
+			test.Error("state root count fraud proof does not check against the block header")
+		} else {
+			// swap the kind of the fraud proof
+			countFp.kind = MissingStateRootFraud + ExtraStateRootFraud - kinds[i]
+			if badBlocks[i].VerifyFraudProof(*countFp) != false {
+				test.Error("state root count fraud proof of the wrong kind should not check")
+			}
+		}
+	}
+
+	// check bad block (corrupted intermediate state)
+	badBlock = corruptBlockInterStates(goodBlock)
+	goodFp, err := badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if goodFp == nil {
+		test.Error("should return a fraud proof")
+	}
+
+	// verify fraud proof of bad block
+	ret := badBlock.VerifyFraudProof(*goodFp)
+	if ret != true {
+		test.Error("fraud proof does not check")
+	}
+
+	// verify fraud proof of bad block from its header only (light client)
+	header := NewBlockHeader(nil, 0, badBlock.dataRoot, badBlock.stateRoot, uint64(len(badBlock.transactions)),
+		uint64(len(badBlock.chunks)), params.Digest())
+	ret = VerifyFraudProof(header, *goodFp, params, DefaultStateMachine{})
+	if ret != true {
+		test.Error("fraud proof does not check against the block header")
+	}
+
+	// verify fraud proof of bad block without a state machine, parameters or header
+	if VerifyFraudProof(header, *goodFp, params, nil) || VerifyFraudProof(header, *goodFp, nil, DefaultStateMachine{}) ||
+		VerifyFraudProof(nil, *goodFp, params, DefaultStateMachine{}) {
+		test.Error("fraud proof should not check without a state machine, parameters or header")
+	}
+
+	// verify fraud proof of bad block against the header of another block with the same data
+	header = NewBlockHeader(nil, 1, badBlock.dataRoot, badBlock.stateRoot, uint64(len(badBlock.transactions)),
+		uint64(len(badBlock.chunks)), params.Digest())
+	ret = VerifyFraudProof(header, *goodFp, params, DefaultStateMachine{})
+	if ret != false {
+		test.Error("fraud proof should not check against another block")
+	}
+
+	// verify fraud proof of a correct window of transactions
+	stateTree = generateStateTree()
+	rebuiltBlock, err := NewBlock(goodTransaction, stateTree, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	badFp, err = badBlock.generateFraudProof(2, rebuiltBlock.interStateRoots[1], stateTree)
+	if err != nil {
+		test.Error(err)
+	} else if badBlock.VerifyFraudProof(*badFp) != false {
+		test.Error("fraud proof of a correct window should not check")
+	}
+
+	// check bad block (invalid read data)
+	badBlock = corruptBlockReadData(goodBlock)
+	readFp, err := badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if readFp == nil {
+		test.Error("should return a fraud proof")
+	} else if badBlock.VerifyFraudProof(*readFp) != true {
+		test.Error("fraud proof does not check")
+	}
+
+	// verify corrupted fraud proof (corrupted chunks proof)
+	corruptedFp := corruptFraudproofChunks(goodFp)
+	ret = badBlock.VerifyFraudProof(*corruptedFp)
+	if ret != false {
+		test.Error("invalid fraud proof should not check")
+	}
+
+	// verify corrupted fraud proof (corrupted state proof)
+	corruptedFp = corruptFraudproofState(goodFp)
+	ret = badBlock.VerifyFraudProof(*corruptedFp)
+	if ret != false {
+		test.Error("invalid fraud proof should not check")
+	}
+}
+
+func TestBlockchain(test *testing.T) {
+	// add good blocks to blockchain
+	transactions, stateTree, params, sm := generateBlockInput(1000000)
+	storage := NewMemoryStorage()
+	blockchain, err := NewBlockchain(params, sm, storage)
+	if err != nil {
+		test.Fatal(err)
+	}
+	firstBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	transactions, _, _, _ = generateBlockInput(1000000)
+	goodBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	goodBlock.SetParent(firstBlock.Header())
+	thirdBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	thirdBlock.SetParent(goodBlock.Header())
+	blockchain.Append(firstBlock) // add a first block
+	fp, err := blockchain.Append(goodBlock) // add a second block
+	if err != nil {
+		test.Error(err)
+	} else if fp != nil {
+		test.Error("should not return a fraud proof")
+	}
+
+	// add a block that does not use the parameters of the blockchain, and one that uses identical parameters
+	otherParams := &ChainParams{3, params.ChunkSize, params.Hash, params.MaxTransactionSize, 0}
+	transactions, stateTree, _, _ = generateBlockInput(1000)
+	otherBlock, _ := NewBlock(transactions, stateTree, otherParams, sm)
+	_, err = blockchain.Append(otherBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	sameParamsBlock, _ := NewBlock(generateAsymmetricTransactions(2), generateStateTree(), DefaultChainParams(), sm)
+	fp, err = blockchain.Append(sameParamsBlock)
+	if err != nil || fp != nil {
+		test.Error("should append a block using identical parameters")
+	}
+
+	// add a block that is already in the blockchain, and blocks whose parent or height is wrong
+	_, err = blockchain.Append(firstBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	orphanBlock, _ := NewBlock(generateAsymmetricTransactions(1), generateStateTree(), params, sm)
+	orphanBlock.SetParent(otherBlock.Header())
+	_, err = blockchain.Append(orphanBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	orphanBlock.SetParent(nil)
+	orphanBlock.height = 1
+	_, err = blockchain.Append(orphanBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// add bad block to blockchain (corrupted intermediate state)
+	badBlock := corruptBlockInterStates(goodBlock)
+	fp, err = blockchain.Append(badBlock)
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil {
+		test.Error("should return a fraud proof")
+	}
+
+	// add a child of the bad block
+	invalid, err := blockchain.IsInvalid(badBlock.Header().Hash())
+	if err != nil || invalid != true {
+		test.Error("bad block should be invalid")
+	}
+	orphanBlock.SetParent(badBlock.Header())
+	_, err = blockchain.Append(orphanBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// add bad block to blockchain (corrupted transactions)
+	fp, err = blockchain.Append(corruptBlockTransactions(goodBlock))
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil || fp.kind != InvalidTransactionFraud {
+		test.Error("should return an invalid transaction fraud proof")
+	}
+
+	// add bad block with a new state (corrupted intermediate state); the state is left untouched
+	fp, err = blockchain.Append(corruptBlockInterStates(thirdBlock))
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil {
+		test.Error("should return a fraud proof")
+	}
+	key, newStateRoot := thirdBlock.transactions[0].writeKeys[0], thirdBlock.interStateRoots[0]
+	storedStateTree := smt.NewSparseMerkleTree(prefixStore{storage, statePrefix}, params.Hash())
+	_, err = storedStateTree.GetForRoot(key, newStateRoot)
+	if err == nil {
+		test.Error("the state of a rejected block should not be stored")
+	}
+	fp, err = blockchain.Append(thirdBlock)
+	if err != nil {
+		test.Error(err)
+	} else if fp != nil {
+		test.Error("should not return a fraud proof")
+	}
+	_, err = storedStateTree.GetForRoot(key, newStateRoot)
+	if err != nil {
+		test.Error("the state of an appended block should be stored")
+	}
+}
+
+func TestPersistentBlockchain(test *testing.T) {
+	// add good blocks to a blockchain stored on disk
+	dir := test.TempDir()
+	storage, err := OpenLevelDBStorage(dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	transactions, stateTree, params, sm := generateBlockInput(100000)
+	blockchain, err := NewBlockchain(params, sm, storage)
+	if err != nil {
+		test.Fatal(err)
+	}
+	firstBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	secondBlock, _ := NewBlock(generateCompareAndSwapTransactions(10), stateTree, params, sm)
+	secondBlock.SetParent(firstBlock.Header())
+	for _, b := range []*Block{firstBlock, secondBlock} {
+		fp, err := blockchain.Append(b)
+		if err != nil {
+			test.Fatal(err)
+		} else if fp != nil {
+			test.Fatal("should not return a fraud proof")
+		}
+	}
+	err = blockchain.Close()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// reopen the blockchain
+	storage, err = OpenLevelDBStorage(dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	blockchain, err = NewBlockchain(params, sm, storage)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer blockchain.Close()
+	if blockchain.length != 2 || blockchain.last.prev == nil {
+		test.Fatal("blockchain not reopened correctly")
+	}
+	if bytes.Compare(blockchain.last.Header().Hash(), secondBlock.Header().Hash()) != 0 ||
+		bytes.Compare(blockchain.last.prev.Header().Hash(), firstBlock.Header().Hash()) != 0 {
+		test.Error("blocks not reopened correctly")
+	}
+	if bytes.Compare(blockchain.stateTree.Root(), stateTree.Root()) != 0 {
+		test.Error("state not reopened correctly")
+	}
+
+	// add a bad block and a good block on top of the reopened blockchain
+	thirdBlock, _ := NewBlock(generateAsymmetricTransactions(10), stateTree, params, sm)
+	thirdBlock.SetParent(secondBlock.Header())
+	badBlock := corruptBlockTransactions(thirdBlock)
+	fp, err := blockchain.Append(badBlock)
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil || badBlock.VerifyFraudProof(*fp) != true {
+		test.Error("should return a fraud proof")
+	}
+	fp, err = blockchain.Append(thirdBlock)
+	if err != nil {
+		test.Error(err)
+	} else if fp != nil || blockchain.length != 3 {
+		test.Error("should append the block")
+	}
+}
+
+func TestForkChoice(test *testing.T) {
+	// create two branches on top of a first block
+	params, sm := DefaultChainParams(), DefaultStateMachine{}
+	transactions := generateAsymmetricTransactions(4)
+	stateTree, otherStateTree := generateStateTree(), generateStateTree()
+	firstBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	NewBlock(transactions, otherStateTree, params, sm)
+	shortBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	shortBlock.SetParent(firstBlock.Header())
+	forkBlock, _ := NewBlock(generateAsymmetricTransactions(4), otherStateTree, params, sm)
+	forkBlock.SetParent(firstBlock.Header())
+	longBlock, _ := NewBlock(generateAsymmetricTransactions(4), otherStateTree, params, sm)
+	longBlock.SetParent(forkBlock.Header())
+
+	// add the blocks; the longest chain wins
+	storage := NewMemoryStorage()
+	blockchain, err := NewBlockchain(params, sm, storage)
+	if err != nil {
+		test.Fatal(err)
+	}
+	lasts := []*Block{firstBlock, shortBlock, shortBlock, longBlock}
+	for i, b := range []*Block{firstBlock, shortBlock, forkBlock, longBlock} {
+		fp, err := blockchain.Append(b)
+		if err != nil {
+			test.Fatal(err)
+		} else if fp != nil {
+			test.Fatal("should not return a fraud proof")
+		}
+		if blockchain.last != lasts[i] {
+			test.Error("blockchain should end with the longest chain")
+		}
+	}
+	if blockchain.length != 3 || bytes.Compare(blockchain.stateTree.Root(), otherStateTree.Root()) != 0 {
+		test.Error("blockchain not reorganized correctly")
+	}
+
+	// invalidate the longest branch; it is pruned and the blockchain goes back to the other one
+	_, err = blockchain.invalidate(forkBlock)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if blockchain.last != shortBlock || blockchain.length != 2 || len(blockchain.blocks) != 2 {
+		test.Error("invalid branch not pruned correctly")
+	}
+	if bytes.Compare(blockchain.stateTree.Root(), stateTree.Root()) != 0 {
+		test.Error("state not rolled back correctly")
+	}
+
+	// the block tree is stored one key per block, and reopens without the pruned branch
+	for _, prefix := range [][]byte{treePrefix, headerPrefix, bodyPrefix} {
+		keys, err := storage.Keys(prefix)
+		if err != nil || len(keys) != 2 {
+			test.Error("block tree not stored correctly")
+		}
+	}
+	reopened, err := NewBlockchain(params, sm, storage)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(reopened.blocks) != 2 || bytes.Compare(reopened.last.Header().Hash(), shortBlock.Header().Hash()) != 0 {
+		test.Error("block tree not reopened correctly")
+	}
+	_, err = blockchain.Append(longBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// look blocks up by hash and by height
+	b, err := blockchain.BlockByHash(shortBlock.Header().Hash())
+	if err != nil || b != shortBlock {
+		test.Error("block not found by hash")
+	}
+	b, err = blockchain.BlockByHeight(0)
+	if err != nil || b != firstBlock {
+		test.Error("block not found by height")
+	}
+	_, err = blockchain.BlockByHash(longBlock.Header().Hash())
+	if err == nil {
+		test.Error("should return an error")
+	}
+	_, err = blockchain.BlockByHeight(2)
+	if err == nil {
+		test.Error("should return an error")
+	}
+}
+
+func TestSubmitFraudProof(test *testing.T) {
+	// create a valid block and an invalid sibling with the same state, and a block on top of the invalid one
+	params, sm := DefaultChainParams(), DefaultStateMachine{}
+	transactions := generateAsymmetricTransactions(4)
+	stateTree, otherStateTree := generateStateTree(), generateStateTree()
+	firstBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	NewBlock(transactions, otherStateTree, params, sm)
+	goodBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	goodBlock.SetParent(firstBlock.Header())
+	badBlock := corruptBlockInterStates(goodBlock)
+	fp, err := badBlock.CheckBlock(otherStateTree, firstBlock.Header())
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil {
+		test.Fatal("should return a fraud proof")
+	}
+	childBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	childBlock.SetParent(badBlock.Header())
+
+	blockchain, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	var events []InvalidBlockEvent
+	blockchain.OnInvalidBlock(func(event InvalidBlockEvent) {
+		events = append(events, event)
+	})
+	for _, b := range []*Block{firstBlock, goodBlock} {
+		_, err = blockchain.Append(b)
+		if err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// add the invalid block without checking it, as if the fraud was only detected later
+	badBlock.prev = firstBlock
+	blockchain.blocks[string(badBlock.Header().Hash())] = badBlock
+	_, err = blockchain.Append(childBlock)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if blockchain.last != childBlock {
+		test.Fatal("blockchain should end with the child block")
+	}
+
+	// submit wrong fraud proofs
+	err = blockchain.SubmitFraudProof(goodBlock.Header().Hash(), *fp)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	err = blockchain.SubmitFraudProof(childBlock.Header().Hash(), *fp)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	err = blockchain.SubmitFraudProof(badBlock.Header().Hash(), *corruptFraudproofState(copyFraudproof(fp)))
+	if err == nil {
+		test.Error("should return an error")
+	}
+	if len(events) != 0 || blockchain.last != childBlock {
+		test.Error("wrong fraud proofs should be ignored")
+	}
+
+	// submit the fraud proof; the block and its descendants are pruned and the blockchain goes back to the valid block
+	err = blockchain.SubmitFraudProof(badBlock.Header().Hash(), *fp)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if blockchain.last != goodBlock || blockchain.length != 2 || len(blockchain.blocks) != 2 {
+		test.Error("invalid block not pruned correctly")
+	}
+	if bytes.Compare(blockchain.stateTree.Root(), goodBlock.postStateRoot()) != 0 {
+		test.Error("state not rolled back correctly")
+	}
+	for _, b := range []*Block{badBlock, childBlock} {
+		invalid, err := blockchain.IsInvalid(b.Header().Hash())
+		if err != nil || !invalid {
+			test.Error("block should be marked invalid")
+		}
+	}
+	if len(events) != 1 || len(events[0].Blocks) != 2 || events[0].Last != goodBlock ||
+		bytes.Compare(events[0].Blocks[0], badBlock.Header().Hash()) != 0 ||
+		bytes.Compare(events[0].Blocks[1], childBlock.Header().Hash()) != 0 {
+		test.Error("invalid block event not emitted correctly")
+	}
+
+	// pruned blocks cannot be appended again
+	for _, b := range []*Block{badBlock, childBlock} {
+		_, err = blockchain.Append(b)
+		if err == nil {
+			test.Error("should return an error")
+		}
+	}
+
+	// fraud proofs generated when appending a block are emitted too
+	otherBadBlock := corruptBlockTransactions(goodBlock)
+	fp, err = blockchain.Append(otherBadBlock)
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil {
+		test.Error("should return a fraud proof")
+	}
+	if len(events) != 2 || events[1].Proof != fp || len(events[1].Blocks) != 1 ||
+		bytes.Compare(events[1].Blocks[0], otherBadBlock.Header().Hash()) != 0 {
+		test.Error("invalid block event not emitted correctly")
+	}
+	_, err = blockchain.Append(otherBadBlock)
+	if err == nil {
+		test.Error("should return an error")
+	}
+}
+
+func TestStateRootFraud(test *testing.T) {
+	params, sm := DefaultChainParams(), DefaultStateMachine{}
+	stateTree := generateStateTree()
+	firstBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	goodBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	goodBlock.SetParent(firstBlock.Header())
+	blockchain, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	_, err = blockchain.Append(firstBlock)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// a block whose header commits to another state root than its last intermediate state root
+	h := sha512.New512_256()
+	h.Write([]byte("random"))
+	badBlock := *goodBlock
+	badBlock.stateRoot = h.Sum(nil)
+	fp, err := blockchain.Append(&badBlock)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != HeaderStateRootFraud {
+		test.Fatal("should return a header state root fraud proof")
+	}
+	if !VerifyFraudProof(badBlock.Header(), *fp, params, sm) {
+		test.Error("header state root fraud proof does not check against the block header")
+	}
+	fp, err = goodBlock.generateHeaderStateRootFraudProof()
+	if err != nil {
+		test.Fatal(err)
+	} else if goodBlock.VerifyFraudProof(*fp) {
+		test.Error("header state root fraud proof of a valid block should not check")
+	}
+
+	// blocks applied on top of another state than the one of their parent, or than the empty state
+	otherBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	fp, err = otherBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != ParentStateRootFraud {
+		test.Fatal("should return a parent state root fraud proof")
+	}
+	if !VerifyFraudProof(otherBlock.Header(), *fp, params, sm) {
+		test.Error("parent state root fraud proof does not check against the block header")
+	}
+	otherBlock.SetParent(firstBlock.Header())
+	fp, err = blockchain.Append(otherBlock)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != ParentStateRootFraud {
+		test.Fatal("should return a parent state root fraud proof")
+	}
+	buff, _ := fp.MarshalBinary()
+	var unmarshaledFp FraudProof
+	err = unmarshaledFp.UnmarshalBinary(buff)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !VerifyFraudProof(otherBlock.Header(), unmarshaledFp, params, sm) {
+		test.Error("parent state root fraud proof does not check against the block header")
+	}
+	unmarshaledFp.parentHeader = nil
+	if VerifyFraudProof(otherBlock.Header(), unmarshaledFp, params, sm) {
+		test.Error("parent state root fraud proof without the parent header should not check")
+	}
+	fp, err = goodBlock.generateParentStateRootFraudProof(firstBlock.Header())
+	if err != nil {
+		test.Fatal(err)
+	} else if goodBlock.VerifyFraudProof(*fp) {
+		test.Error("parent state root fraud proof of a valid block should not check")
+	}
+
+	// the valid block is appended
+	fp, err = blockchain.Append(goodBlock)
+	if err != nil || fp != nil {
+		test.Error("should append the valid block")
+	}
+}
+
+func TestBlockHeader(test *testing.T) {
+	// encode and decode a block header
+	params := DefaultChainParams()
+	h := sha512.Sum512_256([]byte("random"))
+	header := NewBlockHeader(h[:], 1, h[:], h[:], 10, 3, params.Digest())
+	buff, err := header.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	decoded := &BlockHeader{}
+	err = decoded.UnmarshalBinary(buff)
+	if err != nil {
+		test.Error(err)
+	} else if bytes.Compare(decoded.Hash(), header.Hash()) != 0 {
+		test.Error("block header not encoded and decoded correctly")
+	}
+
+	// decode malformed block headers
+	for i := 0; i < len(buff); i++ {
+		if decoded.UnmarshalBinary(buff[:i]) == nil {
+			test.Error("truncated block header should return an error")
+			break
+		}
+	}
+	if decoded.UnmarshalBinary(append(buff, 0x0)) == nil {
+		test.Error("block header with trailing bytes should return an error")
+	}
+
+	// the hash commits to the parent and to the parameters
+	otherParams := &ChainParams{3, params.ChunkSize, params.Hash, params.MaxTransactionSize, 0}
+	namespacedParams := &ChainParams{params.Step, params.ChunkSize, params.Hash, params.MaxTransactionSize, 8}
+	otherHeaders := []*BlockHeader{
+		NewBlockHeader(nil, 1, h[:], h[:], 10, 3, params.Digest()),
+		NewBlockHeader(h[:], 1, h[:], h[:], 10, 3, otherParams.Digest()),
+		NewBlockHeader(h[:], 1, h[:], h[:], 10, 4, params.Digest()),
+		NewBlockHeader(h[:], 1, h[:], h[:], 10, 3, namespacedParams.Digest()),
+	}
+	for _, otherHeader := range otherHeaders {
+		if bytes.Compare(otherHeader.Hash(), header.Hash()) == 0 {
+			test.Error("block headers should have different hashes")
+		}
+	}
+}
+
+func TestStateMachine(test *testing.T) {
+	// create good block (compare-and-swap transactions)
+	goodTransaction := generateCompareAndSwapTransactions(10)
+	goodBlock, err := NewBlock(goodTransaction, generateStateTree(), DefaultChainParams(), CompareAndSwapStateMachine{})
+	if err != nil {
+		test.Error(err)
+	}
+	fp, err := goodBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if fp != nil {
+		test.Error("should not return a fraud proof")
+	}
+
+	// create bad block (invalid compare-and-swap transaction accepted by the default state machine)
+	badTransaction := generateCompareAndSwapTransactions(10)
+	badTransaction[5].oldData = badTransaction[3].newData
+	_, err = NewBlock(badTransaction, generateStateTree(), DefaultChainParams(), CompareAndSwapStateMachine{})
+	if err != ErrInvalidTransaction {
+		test.Error("should return an invalid transaction error")
+	}
+	badBlock, err := NewBlock(badTransaction, generateStateTree(), DefaultChainParams(), DefaultStateMachine{})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// check bad block with the compare-and-swap state machine
+	badBlock.stateMachine = CompareAndSwapStateMachine{}
+	fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil {
+		test.Fatal("should return a fraud proof")
+	}
+
+	// verify fraud proof with both state machines
+	ret := VerifyFraudProof(badBlock.Header(), *fp, badBlock.params, CompareAndSwapStateMachine{})
+	if ret != true {
+		test.Error("fraud proof does not check")
+	}
+	ret = VerifyFraudProof(badBlock.Header(), *fp, badBlock.params, DefaultStateMachine{})
+	if ret != false {
+		test.Error("fraud proof should not check with the default state machine")
+	}
+
+	// append the bad block, built with the default state machine, to a compare-and-swap blockchain
+	blockchain, err := NewBlockchain(DefaultChainParams(), CompareAndSwapStateMachine{}, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	badBlock, _ = NewBlock(badTransaction, generateStateTree(), DefaultChainParams(), DefaultStateMachine{})
+	fp, err = blockchain.Append(badBlock)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil {
+		test.Fatal("should return a fraud proof")
+	}
+	if !VerifyFraudProof(badBlock.Header(), *fp, badBlock.params, CompareAndSwapStateMachine{}) {
+		test.Error("fraud proof does not check")
+	}
+	if blockchain.last != nil {
+		test.Error("the bad block should not be appended")
+	}
+	if _, ok := badBlock.stateMachine.(DefaultStateMachine); !ok {
+		test.Error("the rejected block should keep its state machine")
+	}
+
+	// create good block (transactions reading more keys than they write, with arbitrary data)
+	goodBlock, err = NewBlock(generateAsymmetricTransactions(10), generateStateTree(), DefaultChainParams(), DefaultStateMachine{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	fp, err = goodBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if fp != nil {
+		test.Error("should not return a fraud proof")
+	}
+
+	// check bad block (invalid read data)
+	badBlock = corruptBlockReadData(goodBlock)
+	fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Error(err)
+	} else if fp == nil || fp.kind != StateTransitionFraud {
+		test.Error("should return a state transition fraud proof")
+	} else if badBlock.VerifyFraudProof(*fp) != true {
+		test.Error("fraud proof does not check")
+	}
+}
+
+func TestChainParams(test *testing.T) {
+	// create blockchains with invalid parameters
+	_, err := NewBlockchain(&ChainParams{0, 256, sha512.New512_256, 1000, 0}, DefaultStateMachine{}, NewMemoryStorage())
+	if err == nil {
+		test.Error("should return an error")
+	}
+	_, err = NewBlockchain(&ChainParams{2, chunkHeaderSize, sha512.New512_256, 1000, 0}, DefaultStateMachine{}, NewMemoryStorage())
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// create bad block (transaction larger than the maximum transaction size)
+	goodTransaction, _, _, sm := generateBlockInput(100000)
+	_, err = NewBlock(goodTransaction, generateStateTree(), &ChainParams{3, 100, sha512.New512_256, 100, 0}, sm)
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// small chunks (transactions spanning several chunks) and large chunks
+	for _, chunkSize := range []int{100, 4096} {
+		// create good block with custom parameters
+		params := &ChainParams{3, chunkSize, sha512.New512_256, 1000, 0}
+		goodBlock, err := NewBlock(goodTransaction, generateStateTree(), params, sm)
+		if err != nil {
+			test.Fatal(err)
+		}
+		fp, err := goodBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Error(err)
+		} else if fp != nil {
+			test.Error("should not return a fraud proof")
+		}
+
+		// check bad block (corrupted chunk header)
+		badBlock := corruptBlockChunkHeader(goodBlock)
+		fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Error(err)
+		} else if fp == nil || fp.kind != BadEncodingFraud {
+			test.Error("should return a bad encoding fraud proof")
+		} else if badBlock.VerifyFraudProof(*fp) != true {
+			test.Error("bad encoding fraud proof does not check")
+		}
+
+		// check bad block (corrupted intermediate state), and verify its fraud proof with both parameters
+		badBlock = corruptBlockInterStates(goodBlock)
+		fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Fatal(err)
+		} else if fp == nil {
+			test.Fatal("should return a fraud proof")
+		}
+		ret := VerifyFraudProof(badBlock.Header(), *fp, params, sm)
+		if ret != true {
+			test.Error("fraud proof does not check")
+		}
+		ret = VerifyFraudProof(badBlock.Header(), *fp, DefaultChainParams(), sm)
+		if ret != false {
+			test.Error("fraud proof should not check with other parameters")
+		}
+	}
+}
+
+func TestChunkBoundaries(test *testing.T) {
+	// transactions much larger than chunks, and windows beginning and ending at chunk boundaries
+	goodTransaction := generateLargeTransactions(8, 5000)
+	rootSize := 1 + rootIndexSize + sha512.Size256
+	paramsList := []*ChainParams{
+		{2, 100, sha512.New512_256, 1 << 20, 0},
+		{1, chunkHeaderSize + rootSize + len(goodTransaction[0].Serialize()), sha512.New512_256, 1 << 20, 0},
+		{2, 100, sha512.New512_256, 1 << 20, 8},
+	}
+	for _, params := range paramsList {
+		transactions := setNamespace(goodTransaction, make([]byte, params.NamespaceSize))
+		goodBlock, err := NewBlock(transactions, generateStateTree(), params, DefaultStateMachine{})
+		if err != nil {
+			test.Fatal(err)
+		}
+		fp, err := goodBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Error(err)
+		} else if fp != nil {
+			test.Error("should not return a fraud proof")
+		}
+
+		// check bad blocks (invalid transaction, corrupted intermediate state, and invalid read data)
+		badBlocks := []*Block{
+			corruptBlockTransactions(goodBlock),
+			corruptBlockInterStates(goodBlock),
+			corruptBlockReadData(goodBlock),
+		}
+		for _, badBlock := range badBlocks {
+			fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+			if err != nil {
+				test.Fatal(err)
+			} else if fp == nil {
+				test.Fatal("should return a fraud proof")
+			}
+			if VerifyFraudProof(badBlock.Header(), *fp, params, DefaultStateMachine{}) != true {
+				test.Error("fraud proof does not check")
+			}
+			if fp.kind == StateTransitionFraud && len(fp.chunks) < params.Step*5000/params.ChunkSize {
+				test.Error("fraud proof should hold every chunk of the window")
+			}
+		}
+
+		// windows beginning and ending at chunk boundaries only take the chunks of their records
+		if params.Step == 1 {
+			size := params.ChunkSize - chunkHeaderSize
+			_, offsets, _, _ := makeChunks(params, goodTransaction, append([][]byte{goodBlock.prevStateRoot}, goodBlock.interStateRoots...))
+			if offsets[2] != size || offsets[4] != 2*size {
+				test.Fatal("windows should begin at chunk boundaries")
+			}
+			fp, err = goodBlock.proveRecords(StateTransitionFraud, 2, 4)
+			if err != nil {
+				test.Error(err)
+			} else if len(fp.chunksIndexes) != 2 || fp.chunksIndexes[0] != 1 || fp.recordIndex != 0 {
+				test.Error("fraud proof should hold exactly the chunks of the window")
+			}
+		}
+	}
+}
+
+func TestDataSquare(test *testing.T) {
+	// create a block; its chunks are arranged in the smallest square holding them, and extended
+	transactions, stateTree, params, sm := generateBlockInput(100000)
+	goodBlock, err := NewBlock(transactions, stateTree, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	square := goodBlock.dataSquare
+	k := square.width / 2
+	if k*k < len(goodBlock.chunks) || (k/2)*(k/2) >= len(goodBlock.chunks) || len(square.shares) != 4*k*k {
+		test.Fatal("data square of the wrong width")
+	}
+	if bytes.Compare(square.dataRoot(params), goodBlock.Header().dataRoot) != 0 {
+		test.Error("data root should commit to the row and column roots")
+	}
+	for i := 0; i < len(goodBlock.chunks); i++ {
+		if bytes.Compare(square.shares[(i/k)*square.width+i%k], makeShare(params, nil, goodBlock.chunks[i])) != 0 {
+			test.Fatal("chunks should be stored row by row in the original square")
+		}
+	}
+
+	// every row and column can be recovered from any half of its shares
+	enc, err := reedsolomon.New(k, k)
+	if err != nil {
+		test.Fatal(err)
+	}
+	for i := 0; i < square.width; i++ {
+		for _, shares := range [][][]byte{square.row(i), square.col(i)} {
+			partial := make([][]byte, len(shares))
+			for j := 0; j < len(shares); j += 2 {
+				partial[j] = shares[j]
+			}
+			err = enc.Reconstruct(partial)
+			if err != nil {
+				test.Fatal(err)
+			}
+			for j := 0; j < len(shares); j++ {
+				if bytes.Compare(partial[j], shares[j]) != 0 {
+					test.Fatal("shares not recovered correctly")
+				}
+			}
+		}
+	}
+
+	// prove shares against the data root
+	root := goodBlock.Header().dataRoot
+	for _, position := range [][]int{{0, 0}, {0, k}, {square.width - 1, square.width - 1}} {
+		row, col := position[0], position[1]
+		proof, err := square.proveShare(params, row, col)
+		if err != nil {
+			test.Fatal(err)
+		}
+		share := square.shares[row*square.width+col]
+		if !verifyShareProof(params, root, share, proof, row, col, square.width) {
+			test.Error("share proof does not check")
+		}
+		if verifyShareProof(params, root, share, proof, row, col+1, square.width) {
+			test.Error("share proof should not check at another position")
+		}
+	}
+
+	// the header fixes the number of chunks
+	fp, err := goodBlock.generateBadEncodingFraudProof(len(goodBlock.chunks) - 1)
+	if err != nil {
+		test.Fatal(err)
+	}
+	header := goodBlock.Header()
+	header.numChunks++
+	if VerifyFraudProof(header, *fp, params, sm) != false {
+		test.Error("fraud proof should not check against another number of chunks")
+	}
+
+	// check bad block (incorrectly erasure coded)
+	badBlock := corruptBlockErasureCoding(goodBlock)
+	fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != BadErasureCodingFraud || fp.axisIndex != 0 {
+		test.Fatal("should return a bad erasure coding fraud proof")
+	}
+	if VerifyFraudProof(badBlock.Header(), *fp, params, nil) != true {
+		test.Error("bad erasure coding fraud proof does not check against the block header")
+	}
+	buff, err := fp.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	decoded := &FraudProof{}
+	err = decoded.UnmarshalBinary(buff)
+	if err != nil {
+		test.Error(err)
+	} else if VerifyFraudProof(badBlock.Header(), *decoded, params, nil) != true {
+		test.Error("bad erasure coding fraud proof not encoded and decoded correctly")
+	}
+	decoded, err = FraudProofFromProto(fp.ToProto())
+	if err != nil {
+		test.Error(err)
+	} else if VerifyFraudProof(badBlock.Header(), *decoded, params, nil) != true {
+		test.Error("bad erasure coding fraud proof not converted to and from protocol buffers correctly")
+	}
+
+	// the column holding the corrupted share is incorrectly erasure coded too
+	fp, err = badBlock.generateBadErasureCodingFraudProof(2*square.width - 1)
+	if err != nil {
+		test.Error(err)
+	} else if VerifyFraudProof(badBlock.Header(), *fp, params, nil) != true {
+		test.Error("bad erasure coding fraud proof of a column does not check")
+	}
+
+	// verify bad erasure coding fraud proofs of correctly erasure coded rows, and malformed ones
+	fp, err = goodBlock.generateBadErasureCodingFraudProof(0)
+	if err != nil {
+		test.Fatal(err)
+	} else if goodBlock.VerifyFraudProof(*fp) != false {
+		test.Error("bad erasure coding fraud proof of a correctly erasure coded row should not check")
+	}
+	fp, _ = badBlock.generateBadErasureCodingFraudProof(0)
+	malformedFp := copyFraudproof(fp)
+	malformedFp.chunksIndexes[1] = malformedFp.chunksIndexes[0]
+	if badBlock.VerifyFraudProof(*malformedFp) != false {
+		test.Error("bad erasure coding fraud proof with duplicated shares should not check")
+	}
+	malformedFp = copyFraudproof(fp)
+	malformedFp.axisIndex = 1
+	if badBlock.VerifyFraudProof(*malformedFp) != false {
+		test.Error("bad erasure coding fraud proof of another row should not check")
+	}
+
+	// blocks cannot hold more chunks than the widest data square
+	_, err = newDataSquare(params, make([][]byte, MaxChunks+1), nil)
+	if err == nil {
+		test.Error("should return an error")
+	}
+}
+
+func TestSampling(test *testing.T) {
+	// a full node serves the shares of its blocks
+	transactions, stateTree, params, sm := generateBlockInput(10000)
+	goodBlock, err := NewBlock(transactions, stateTree, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fullNode, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	_, err = fullNode.Append(goodBlock)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// sample the block from the full node
+	sampler, err := NewSampler(fullNode, params, 20)
+	if err != nil {
+		test.Fatal(err)
+	}
+	availability, err := sampler.Sample(goodBlock.Header())
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !availability.Available || availability.Samples != 20 || availability.Confidence < 0.99 {
+		test.Error("block data should be available")
+	}
+
+	// sample the block from sources withholding or corrupting shares
+	sources := []ShareSource{
+		&withholdingSource{fullNode, 1, false},
+		&withholdingSource{fullNode, 0, true},
+	}
+	for _, source := range sources {
+		sampler, _ := NewSampler(source, params, 20)
+		availability, err := sampler.Sample(goodBlock.Header())
+		if err != nil {
+			test.Fatal(err)
+		}
+		if availability.Available {
+			test.Error("block data should not be available")
+		}
+	}
+
+	// a light node only admits blocks whose data is available
+	for i, source := range []ShareSource{sources[0], fullNode} {
+		sampler, _ := NewSampler(source, params, 20)
+		lightNode, err := NewBlockchain(params, sm, NewMemoryStorage())
+		if err != nil {
+			test.Fatal(err)
+		}
+		lightNode.AddAdmissionRule(sampler)
+		_, err = lightNode.Append(goodBlock)
+		if i == 0 {
+			invalid, _ := lightNode.IsInvalid(goodBlock.Header().Hash())
+			if err == nil || lightNode.last != nil || invalid {
+				test.Error("block with unavailable data should not be admitted")
+			}
+		} else if err != nil || lightNode.last != goodBlock {
+			test.Error("block with available data should be admitted")
+		}
+	}
+
+	// sample with the wrong parameters or number of samples
+	otherParams := &ChainParams{3, params.ChunkSize, params.Hash, params.MaxTransactionSize, 0}
+	sampler, _ = NewSampler(fullNode, otherParams, 20)
+	_, err = sampler.Sample(goodBlock.Header())
+	if err == nil {
+		test.Error("should return an error")
+	}
+	_, err = NewSampler(fullNode, params, 0)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	if samplingConfidence(1, 1) != 1 || samplingConfidence(64, 0) != 0 {
+		test.Error("wrong sampling confidence")
+	}
+}
+
+func TestHeaderChain(test *testing.T) {
+	// create a valid block and an invalid sibling, and a block on top of the invalid one
+	params, sm := DefaultChainParams(), DefaultStateMachine{}
+	transactions := generateAsymmetricTransactions(4)
+	stateTree, otherStateTree := generateStateTree(), generateStateTree()
+	firstBlock, _ := NewBlock(transactions, stateTree, params, sm)
+	NewBlock(transactions, otherStateTree, params, sm)
+	goodBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	goodBlock.SetParent(firstBlock.Header())
+	badBlock := corruptBlockInterStates(goodBlock)
+	fp, err := badBlock.CheckBlock(otherStateTree, firstBlock.Header())
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil {
+		test.Fatal("should return a fraud proof")
+	}
+	childBlock, _ := NewBlock(generateAsymmetricTransactions(4), stateTree, params, sm)
+	childBlock.SetParent(badBlock.Header())
+
+	// a full node serves the shares of every block
+	fullNode, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	for _, b := range []*Block{firstBlock, goodBlock} {
+		_, err = fullNode.Append(b)
+		if err != nil {
+			test.Fatal(err)
+		}
+	}
+	badBlock.prev = firstBlock
+	fullNode.blocks[string(badBlock.Header().Hash())] = badBlock
+	childBlock.prev = badBlock
+	fullNode.blocks[string(childBlock.Header().Hash())] = childBlock
+
+	// a light node only admits headers of blocks whose data is available
+	sampler, _ := NewSampler(&withholdingSource{fullNode, 1, false}, params, 20)
+	lightNode, err := NewHeaderChain(params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	lightNode.AddAdmissionRule(sampler)
+	err = lightNode.Append(firstBlock.Header())
+	if err == nil || lightNode.last != nil || lightNode.IsInvalid(firstBlock.Header().Hash()) {
+		test.Error("header of a block with unavailable data should not be admitted")
+	}
+	sampler, _ = NewSampler(fullNode, params, 20)
+	lightNode, _ = NewHeaderChain(params, sm)
+	lightNode.AddAdmissionRule(sampler)
+	for _, b := range []*Block{firstBlock, goodBlock, badBlock, childBlock} {
+		err = lightNode.Append(b.Header())
+		if err != nil {
+			test.Fatal(err)
+		}
+	}
+	if bytes.Compare(lightNode.last.Hash(), childBlock.Header().Hash()) != 0 || lightNode.length != 3 {
+		test.Error("header chain should end with the child block")
+	}
+	header, err := lightNode.HeaderByHeight(1)
+	if err != nil || bytes.Compare(header.Hash(), badBlock.Header().Hash()) != 0 {
+		test.Error("wrong header at height 1")
+	}
+
+	// append headers that do not follow the tree or do not use the parameters of the chain
+	err = lightNode.Append(goodBlock.Header())
+	if err == nil {
+		test.Error("should return an error")
+	}
+	otherLightNode, _ := NewHeaderChain(params, sm)
+	err = otherLightNode.Append(childBlock.Header())
+	if err == nil {
+		test.Error("should return an error")
+	}
+	otherParams := &ChainParams{3, params.ChunkSize, params.Hash, params.MaxTransactionSize, 0}
+	otherLightNode, _ = NewHeaderChain(otherParams, sm)
+	err = otherLightNode.Append(firstBlock.Header())
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// submit a wrong fraud proof, then the fraud proof; the header and its descendants are pruned
+	err = lightNode.SubmitFraudProof(goodBlock.Header().Hash(), *fp)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	err = lightNode.SubmitFraudProof(badBlock.Header().Hash(), *fp)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if bytes.Compare(lightNode.last.Hash(), goodBlock.Header().Hash()) != 0 || lightNode.length != 2 ||
+		len(lightNode.headers) != 2 {
+		test.Error("invalid header not pruned correctly")
+	}
+	for _, b := range []*Block{badBlock, childBlock} {
+		if !lightNode.IsInvalid(b.Header().Hash()) {
+			test.Error("block should be marked invalid")
+		}
+		err = lightNode.Append(b.Header())
+		if err == nil {
+			test.Error("should return an error")
+		}
+	}
+}
+
+func TestRecoverBlock(test *testing.T) {
+	transactions, stateTree, params, sm := generateBlockInput(1000)
+	goodBlock, err := NewBlock(transactions, stateTree, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	header := goodBlock.Header()
+
+	// decode the chunks of the block
+	t, s := decodeChunks(params, goodBlock.chunks)
+	if len(t) != len(goodBlock.transactions) || !bytes.Equal(t[len(t)-1].Serialize(),
+		goodBlock.transactions[len(t)-1].Serialize()) || !bytes.Equal(s[0], goodBlock.prevStateRoot) ||
+		len(s) != len(goodBlock.interStateRoots)+1 {
+		test.Error("chunks should decode to the block data")
+	}
+	badChunks := append([][]byte{}, goodBlock.chunks...)
+	badChunks[1] = append([]byte{}, badChunks[1]...)
+	badChunks[1][0] ^= 1
+	t, s = decodeChunks(params, badChunks)
+	if t != nil || s != nil {
+		test.Error("should not decode incorrectly formed chunks")
+	}
+
+	// recover the block from the parity half of every row
+	width := goodBlock.dataSquare.width
+	shares := make([][]byte, width*width)
+	for i := 0; i < width; i++ {
+		for j := width / 2; j < width; j++ {
+			shares[i*width+j] = goodBlock.dataSquare.shares[i*width+j]
+		}
+	}
+	b, err := RecoverBlock(header, shares, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(b.Header().Hash(), header.Hash()) || len(b.transactions) != len(goodBlock.transactions) {
+		test.Error("recovered block should match the original one")
+	}
+
+	// recovering fails without enough shares, with the wrong parameters, or with the shares of another block
+	for i := 0; i < width; i++ {
+		shares[i*width+width-1] = nil
+	}
+	_, err = RecoverBlock(header, shares, params, sm)
+	if err == nil {
+		test.Error("should not recover the block")
+	}
+	otherParams := &ChainParams{3, params.ChunkSize, params.Hash, params.MaxTransactionSize, 0}
+	_, err = RecoverBlock(header, goodBlock.dataSquare.shares, otherParams, sm)
+	if err == nil {
+		test.Error("should return an error")
+	}
+	_, err = RecoverBlock(corruptBlockInterStates(goodBlock).Header(), goodBlock.dataSquare.shares, params, sm)
+	if err == nil {
+		test.Error("should return an error")
+	}
+
+	// a full node resyncs the block from a peer, and appends it
+	peer, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	_, err = peer.Append(goodBlock)
+	if err != nil {
+		test.Fatal(err)
+	}
+	b, err = FetchBlock(header, peer, params, sm)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fullNode, err := NewBlockchain(params, sm, NewMemoryStorage())
+	if err != nil {
+		test.Fatal(err)
+	}
+	fp, err := fullNode.Append(b)
+	if err != nil || fp != nil {
+		test.Error("should append the fetched block")
+	}
+
+	// fetching fails from peers withholding or corrupting shares
+	for _, source := range []ShareSource{&withholdingSource{peer, 1, false}, &withholdingSource{peer, 0, true}} {
+		_, err = FetchBlock(header, source, params, sm)
+		if err == nil {
+			test.Error("should not fetch the block")
+		}
+	}
+
+	// invalid blocks are fetched as committed, so that they can be checked for fraud
+	badBlocks := []*Block{
+		corruptBlockTransactions(goodBlock),
+		corruptBlockChunkHeader(goodBlock),
+		corruptBlockChunkSize(goodBlock),
+		corruptBlockErasureCoding(goodBlock),
+		replaceBlockNumTransactions(goodBlock, len(transactions)+params.Step),
+		replaceBlockNumTransactions(goodBlock, len(transactions)-params.Step),
+	}
+	kinds := []FraudProofKind{InvalidTransactionFraud, BadEncodingFraud, BadEncodingFraud, BadErasureCodingFraud,
+		MissingStateRootFraud, ExtraStateRootFraud}
+	for i, badBlock := range badBlocks {
+		peer.blocks[string(badBlock.Header().Hash())] = badBlock
+		b, err = FetchBlock(badBlock.Header(), peer, params, sm)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !bytes.Equal(b.Header().Hash(), badBlock.Header().Hash()) {
+			test.Error("fetched block should match its header")
+		}
+		fp, err = b.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Fatal(err)
+		} else if fp == nil {
+			test.Fatal("should return a fraud proof")
+		}
+		if fp.kind != kinds[i] {
+			test.Error("wrong kind of fraud proof")
+		}
+		if VerifyFraudProof(badBlock.Header(), *fp, params, sm) != true {
+			test.Error("fraud proof against the fetched block does not check")
+		}
+	}
 }
 
+func TestNamespacedMerkleTree(test *testing.T) {
+	// create a tree whose leaves hold data of one or two namespaces
+	params := &ChainParams{2, 256, sha512.New512_256, 1 << 20, 8}
+	ns := func(b byte) []byte {
+		return bytes.Repeat([]byte{b}, params.NamespaceSize)
+	}
+	ranges := [][]byte{{1, 1}, {1, 2}, {2, 2}, {4, 4}, {4, 4}, {6, 7}}
+	tree, err := NewNamespacedMerkleTree(params)
+	if err != nil {
+		test.Fatal(err)
+	}
+	var leaves [][]byte
+	for i, r := range ranges {
+		leaf := append(append(ns(r[0]), ns(r[1])...), byte(i))
+		err = tree.Push(leaf)
+		if err != nil {
+			test.Fatal(err)
+		}
+		leaves = append(leaves, leaf)
+	}
+	root := tree.Root()
+	if err = tree.Push(append(ns(5), ns(5)...)); err == nil {
+		test.Error("should return an error")
+	}
+	if err = tree.Push(append(ns(8), ns(7)...)); err == nil {
+		test.Error("should return an error")
+	}
+	if bytes.Compare(tree.Root(), root) != 0 {
+		test.Error("rejected leaves should not change the tree")
+	}
+
+	// prove the leaves of present and absent namespaces
+	expected := map[byte][]int{0: {0, 0}, 1: {0, 2}, 2: {1, 3}, 3: {3, 3}, 4: {3, 5}, 5: {5, 5}, 7: {5, 6}, 9: {6, 6}}
+	for namespace, r := range expected {
+		proof, err := tree.ProveNamespace(ns(namespace))
+		if err != nil {
+			test.Fatal(err)
+		}
+		if proof.start != r[0] || proof.end != r[1] {
+			test.Error("wrong range of leaves for the namespace")
+			continue
+		}
+		if !VerifyNamespaceProof(params, root, ns(namespace), leaves[r[0]:r[1]], proof) {
+			test.Error("namespace proof does not check")
+		}
+		if r[1] == r[0] {
+			continue
+		}
+		if VerifyNamespaceProof(params, root, ns(namespace+1), leaves[r[0]:r[1]], proof) {
+			test.Error("namespace proof should not check for another namespace")
+		}
+		if VerifyNamespaceProof(params, root, ns(namespace), leaves[r[0]+1:r[1]], proof) {
+			test.Error("namespace proof with missing leaves should not check")
+		}
+	}
 
-func TestBlock(test *testing.T) {
-	// create bad block (corrupted transactions)
-	_, err :=  NewBlock(generateCorruptedBlockInput())
+	// proofs of part of the leaves of a namespace are not complete
+	proof := tree.proveRange(3, 4)
+	if VerifyNamespaceProof(params, root, ns(4), leaves[3:4], proof) {
+		test.Error("incomplete namespace proof should not check")
+	}
+	if verifyRange(params, leaves[3:4], proof, func([]byte, bool) bool { return true }) == nil {
+		test.Error("inclusion proof does not check")
+	}
+
+	// blocks of a chain using namespaces must sort their transactions, and commit to them through namespaced trees
+	transactions := generateNamespacedTransactions(params, []byte{3, 1, 2})
+	_, err = NewBlock(transactions, generateStateTree(), params, DefaultStateMachine{})
 	if err == nil {
 		test.Error("should return an error")
 	}
-
-	// create good block
-	goodTransaction, stateTree := generateBlockInput(1000000)
-	goodBlock, err :=  NewBlock(goodTransaction, stateTree)
+	transactions = generateNamespacedTransactions(params, []byte{1, 1, 1, 2, 2, 3, 3, 3, 3, 3, 3, 3, 3})
+	goodBlock, err := NewBlock(transactions, generateStateTree(), params, DefaultStateMachine{})
 	if err != nil {
-		test.Error(err)
+		test.Fatal(err)
 	}
-
-	// check good block
-	_, err = goodBlock.CheckBlock(stateTree)
+	fp, err := goodBlock.CheckBlock(generateStateTree(), nil)
 	if err != nil {
 		test.Error(err)
+	} else if fp != nil {
+		test.Error("should not return a fraud proof")
+	}
+	square := goodBlock.dataSquare
+	tree, _ = NewNamespacedMerkleTree(params)
+	leaves = nil
+	for j, share := range square.row(0) {
+		leaf := axisLeaf(params, share, 0, j, square.width)
+		err = tree.Push(leaf)
+		if err != nil {
+			test.Fatal(err)
+		}
+		leaves = append(leaves, leaf)
+	}
+	if bytes.Compare(tree.Root(), square.rowRoots[0]) != 0 {
+		test.Fatal("rows should be committed through namespaced trees")
+	}
+	proof, err = tree.ProveNamespace(ns(2))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if proof.end <= proof.start || !VerifyNamespaceProof(params, square.rowRoots[0], ns(2), leaves[proof.start:proof.end], proof) {
+		test.Error("namespace proof of a row does not check")
 	}
 
-	// check a bad block (corrupted transactions)
-	badBlock := generateBlockWithCorruptedTransactions()
-	_, err = badBlock.CheckBlock(stateTree)
-	if err == nil {
-		test.Error("should return an error")
+	// transactions must have a namespace ID of the namespace size, and cannot use the reserved largest one
+	for _, namespace := range [][]byte{nil, ns(1)[1:], ns(0xff)} {
+		_, err = NewBlock(setNamespace(transactions, namespace), generateStateTree(), params, DefaultStateMachine{})
+		if err == nil {
+			test.Error("should return an error")
+		}
 	}
+	reservedTransactions := append([]Transaction{}, transactions...)
+	reservedTransactions[len(transactions)-1].namespace = ns(0xff)
 
-	// check bad block (corrupted intermediate state)
-	badBlock = corruptBlockInterStates(goodBlock)
-	goodFp, err := badBlock.CheckBlock(stateTree)
+	// fraud proofs against blocks of a chain using namespaces
+	badBlocks := []*Block{
+		corruptBlockInterStates(goodBlock),
+		corruptBlockErasureCoding(goodBlock),
+		replaceBlockTransactions(goodBlock, reservedTransactions),
+	}
+	for _, badBlock := range badBlocks {
+		fp, err = badBlock.CheckBlock(generateStateTree(), nil)
+		if err != nil {
+			test.Fatal(err)
+		} else if fp == nil {
+			test.Fatal("should return a fraud proof")
+		}
+		if VerifyFraudProof(badBlock.Header(), *fp, params, DefaultStateMachine{}) != true {
+			test.Error("fraud proof does not check")
+		}
+	}
+	if fp.kind != InvalidTransactionFraud {
+		test.Error("transaction of the reserved namespace should be shown invalid")
+	}
+
+	// rows and columns whose shares are not sorted by namespace have a nil root, which is proven malformed
+	unsortedBlock := replaceBlockTransactions(goodBlock, generateNamespacedTransactions(params,
+		[]byte{3, 3, 3, 3, 1, 1, 1, 1, 2, 2, 2, 4, 4}))
+	fp, err = unsortedBlock.CheckBlock(generateStateTree(), nil)
 	if err != nil {
-		test.Error(err)
-	} else if goodFp == nil {
-		test.Error("should return a fraud proof")
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != BadErasureCodingFraud || len(fp.chunks) != 0 {
+		test.Fatal("should return a bad erasure coding fraud proof of a malformed root")
+	}
+	if unsortedBlock.dataSquare.roots()[fp.axisIndex] != nil {
+		test.Error("the root of the accused row or column should be nil")
+	}
+	if VerifyFraudProof(unsortedBlock.Header(), *fp, params, nil) != true {
+		test.Error("fraud proof does not check")
+	}
+	goodFp, err := goodBlock.generateBadErasureCodingFraudProof(int(fp.axisIndex))
+	if err != nil {
+		test.Fatal(err)
+	}
+	rootProof, _ := merkleProof(params, goodBlock.dataSquare.roots(), int(fp.axisIndex))
+	goodFp.chunks, goodFp.proofChunks, goodFp.chunksIndexes = nil, [][][]byte{rootProof}, nil
+	if VerifyFraudProof(goodBlock.Header(), *goodFp, params, nil) != false {
+		test.Error("fraud proof of a well formed root should not check")
 	}
 
-	// verify fraud proof of bad block
-	ret := badBlock.VerifyFraudProof(*goodFp)
-	if ret != true {
+	// shares whose range of namespaces differs from the one of their chunk are shown mislabelled, including after
+	// recovering the block from its shares
+	last := len(goodBlock.chunks) - 1
+	mislabelledBlocks := []*Block{
+		relabelBlockShare(goodBlock, 0, append(ns(0), ns(0)...)),
+		relabelBlockShare(goodBlock, last, append(ns(3), ns(4)...)),
+	}
+	for _, badBlock := range mislabelledBlocks {
+		recovered, err := RecoverBlock(badBlock.Header(), badBlock.dataSquare.shares, params, DefaultStateMachine{})
+		if err != nil {
+			test.Fatal(err)
+		}
+		for _, b := range []*Block{badBlock, recovered} {
+			fp, err = b.CheckBlock(generateStateTree(), nil)
+			if err != nil {
+				test.Fatal(err)
+			} else if fp == nil || fp.kind != MislabelledShareFraud {
+				test.Fatal("should return a mislabelled share fraud proof")
+			}
+			if VerifyFraudProof(badBlock.Header(), *fp, params, nil) != true {
+				test.Error("fraud proof does not check")
+			}
+		}
+	}
+	goodFp, err = goodBlock.proveRecords(MislabelledShareFraud, 0, len(parseChunks(params, goodBlock.chunks))-1)
+	if err != nil {
+		test.Fatal(err)
+	} else if VerifyFraudProof(goodBlock.Header(), *goodFp, params, nil) != false {
+		test.Error("mislabelled share fraud proof of correctly labelled shares should not check")
+	}
+
+	// transactions that are not sorted by namespace are shown unsorted, even when the shares holding them are
+	largeParams := &ChainParams{2, 2048, sha512.New512_256, 1 << 20, 8}
+	sortedBlock, err := NewBlock(generateNamespacedTransactions(largeParams, []byte{1, 2, 3, 4}), generateStateTree(),
+		largeParams, DefaultStateMachine{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	unsortedBlock = replaceBlockTransactions(sortedBlock, generateNamespacedTransactions(largeParams, []byte{1, 3, 2, 4}))
+	fp, err = unsortedBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Fatal(err)
+	} else if fp == nil || fp.kind != UnsortedNamespaceFraud {
+		test.Fatal("should return an unsorted namespace fraud proof")
+	}
+	if VerifyFraudProof(unsortedBlock.Header(), *fp, largeParams, nil) != true {
 		test.Error("fraud proof does not check")
 	}
+	goodFp, err = sortedBlock.proveRecords(UnsortedNamespaceFraud, 0, len(parseChunks(largeParams, sortedBlock.chunks))-1)
+	if err != nil {
+		test.Fatal(err)
+	} else if VerifyFraudProof(sortedBlock.Header(), *goodFp, largeParams, nil) != false {
+		test.Error("unsorted namespace fraud proof of sorted transactions should not check")
+	}
 
-	// verify corrupted fraud proof (corrupted chunks proof)
-	corruptedFp := corruptFraudproofChunks(goodFp)
-	ret = badBlock.VerifyFraudProof(*corruptedFp)
-	if ret != false {
-		test.Error("invalid fraud proof should not check")
+	// prove the transactions of present and absent namespaces across the rows of a block, against its header
+	namespaces := append(append(bytes.Repeat([]byte{1}, 30), bytes.Repeat([]byte{3}, 60)...), bytes.Repeat([]byte{4}, 30)...)
+	transactions = generateNamespacedTransactions(params, namespaces)
+	goodBlock, err = NewBlock(transactions, generateStateTree(), params, DefaultStateMachine{})
+	if err != nil {
+		test.Fatal(err)
 	}
+	header := goodBlock.Header()
+	for namespace, count := range map[byte]int{0: 0, 1: 30, 2: 0, 3: 60, 4: 30, 5: 0} {
+		blockProof, err := goodBlock.ProveNamespace(ns(namespace))
+		if err != nil {
+			test.Fatal(err)
+		}
+		t, ok := VerifyBlockNamespaceProof(header, params, ns(namespace), blockProof)
+		if !ok || len(t) != count {
+			test.Error("block namespace proof does not check")
+			continue
+		}
+		for i := 0; i < len(t); i++ {
+			if bytes.Compare(t[i].Serialize(), transactions[bytes.IndexByte(namespaces, namespace)+i].Serialize()) != 0 {
+				test.Error("block namespace proof holds the wrong transactions")
+			}
+		}
 
-	// verify corrupted fraud proof (corrupted state proof)
-	corruptedFp = corruptFraudproofState(goodFp)
-	ret = badBlock.VerifyFraudProof(*corruptedFp)
-	if ret != false {
-		test.Error("invalid fraud proof should not check")
+		// the proof checks after encoding, but not against another namespace or without one of its shares
+		buff, err := blockProof.MarshalBinary()
+		if err != nil {
+			test.Fatal(err)
+		}
+		decoded := &BlockNamespaceProof{}
+		err = decoded.UnmarshalBinary(buff)
+		if err != nil {
+			test.Error(err)
+		} else if t, ok = VerifyBlockNamespaceProof(header, params, ns(namespace), decoded); !ok || len(t) != count {
+			test.Error("block namespace proof not encoded and decoded correctly")
+		}
+		if decoded.UnmarshalBinary(buff[:len(buff)-1]) == nil || decoded.UnmarshalBinary(append(buff, 0)) == nil {
+			test.Error("malformed block namespace proof should return an error")
+		}
+		if count == 0 {
+			continue
+		}
+		if t, ok = VerifyBlockNamespaceProof(header, params, ns(namespace+1), blockProof); ok && len(t) == count {
+			test.Error("block namespace proof should not check for another namespace")
+		}
+		last := len(blockProof.shares) - 1
+		for len(blockProof.shares[last]) == 0 {
+			last--
+		}
+		blockProof.shares[last] = blockProof.shares[last][1:]
+		if _, ok = VerifyBlockNamespaceProof(header, params, ns(namespace), blockProof); ok {
+			test.Error("block namespace proof with a missing share should not check")
+		}
+	}
+	blockProof, _ := goodBlock.ProveNamespace(ns(3))
+	if len(blockProof.shares) < 2 || len(blockProof.shares[1]) == 0 {
+		test.Error("transactions of the namespace should span several rows")
+	}
+	if _, ok := VerifyBlockNamespaceProof(header, params, ns(0xff), blockProof); ok {
+		test.Error("proofs of the reserved namespace should not check")
+	}
+	if _, ok := VerifyBlockNamespaceProof(badBlocks[0].Header(), params, ns(3), blockProof); ok {
+		test.Error("block namespace proof should not check against another block")
 	}
-}
 
-func TestBlockchain(test *testing.T) {
-	// add good blocks to blockchain
-	blockchain := NewBlockchain()
-	goodBlock, _ := NewBlock(generateBlockInput(1000000))
-	blockchain.Append(goodBlock) // add a first block
-	fp, err := blockchain.Append(goodBlock) // add a second block
+	// namespace proofs of a tree can be encoded too
+	buff, err := proof.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	decodedProof := &NamespaceProof{}
+	err = decodedProof.UnmarshalBinary(buff)
 	if err != nil {
 		test.Error(err)
-	} else if fp != nil {
-		test.Error("should not return a fraud proof")
+	} else if !VerifyNamespaceProof(params, square.rowRoots[0], ns(2), leaves[proof.start:proof.end], decodedProof) {
+		test.Error("namespace proof not encoded and decoded correctly")
+	}
+	if decodedProof.UnmarshalBinary(append(buff, 0)) == nil {
+		test.Error("namespace proof with trailing bytes should return an error")
 	}
+}
 
-	// add bad block to blockchain (corrupted intermediate state)
-	fp, err = blockchain.Append(corruptBlockInterStates(goodBlock))
+func TestFraudProofMarshal(test *testing.T) {
+	// generate a fraud proof
+	goodTransaction, stateTree, params, sm := generateBlockInput(1000000)
+	goodBlock, err := NewBlock(goodTransaction, stateTree, params, sm)
 	if err != nil {
 		test.Error(err)
-	} else if fp == nil {
-		test.Error("should return a fraud proof")
+	}
+	badBlock := corruptBlockInterStates(goodBlock)
+	goodFp, err := badBlock.CheckBlock(generateStateTree(), nil)
+	if err != nil {
+		test.Fatal(err)
+	} else if goodFp == nil {
+		test.Fatal("should return a fraud proof")
 	}
 
-	// add bad block to blockchain (corrupted transactions)
-	_, err = blockchain.Append(generateBlockWithCorruptedTransactions())
+	// marshal and unmarshal
+	buff, err := goodFp.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	var fp FraudProof
+	err = fp.UnmarshalBinary(buff)
+	if err != nil {
+		test.Fatal(err)
+	}
+	tmp, _ := fp.MarshalBinary()
+	if bytes.Compare(tmp, buff) != 0 {
+		test.Error("fraud proof not marshaled and unmarshaled correctly")
+	}
+	ret := badBlock.VerifyFraudProof(fp)
+	if ret != true {
+		test.Error("unmarshaled fraud proof does not check")
+	}
+
+	// unmarshal malformed fraud proofs
+	for i := 0; i < len(buff); i++ {
+		if fp.UnmarshalBinary(buff[:i]) == nil {
+			test.Error("truncated fraud proof should return an error")
+			break
+		}
+	}
+	if fp.UnmarshalBinary(append(buff, 0x0)) == nil {
+		test.Error("fraud proof with trailing bytes should return an error")
+	}
+	corrupted := append([]byte{}, buff...)
+	corrupted[0] = FraudProofVersion + 1
+	if fp.UnmarshalBinary(corrupted) == nil {
+		test.Error("fraud proof with unknown version should return an error")
+	}
+	corrupted = append([]byte{}, buff...)
+	corrupted[1] = byte(UnsortedNamespaceFraud) + 1
+	if fp.UnmarshalBinary(corrupted) == nil {
+		test.Error("fraud proof with unknown kind should return an error")
+	}
+	corrupted = append([]byte{}, buff...)
+	corrupted[2], corrupted[3], corrupted[4], corrupted[5] = 0xff, 0xff, 0xff, 0xff
+	if fp.UnmarshalBinary(corrupted) == nil {
+		test.Error("fraud proof with oversized length should return an error")
+	}
+
+	// convert to and from protocol buffers
+	buff, err = proto.Marshal(goodFp.ToProto())
+	if err != nil {
+		test.Fatal(err)
+	}
+	m := &pb.FraudProof{}
+	err = proto.Unmarshal(buff, m)
+	if err != nil {
+		test.Fatal(err)
+	}
+	protoFp, err := FraudProofFromProto(m)
+	if err != nil {
+		test.Fatal(err)
+	}
+	header, err := BlockHeaderFromProto(badBlock.Header().ToProto())
+	if err != nil {
+		test.Fatal(err)
+	}
+	ret = VerifyFraudProof(header, *protoFp, params, sm)
+	if ret != true {
+		test.Error("fraud proof converted from protocol buffers does not check")
+	}
+	m.Chunks = m.Chunks[1:]
+	_, err = FraudProofFromProto(m)
 	if err == nil {
 		test.Error("should return an error")
 	}
@@ -126,8 +1839,8 @@ func TestTiming(test *testing.T) {
 	fmt.Println("Block size: ", blockSize, "Bytes")
 
 	// create good block
-	goodTransaction, stateTree := generateBlockInput(blockSize)
-	goodBlock, err :=  NewBlock(goodTransaction, stateTree)
+	goodTransaction, stateTree, params, sm := generateBlockInput(blockSize)
+	goodBlock, err :=  NewBlock(goodTransaction, stateTree, params, sm)
 	if err != nil {
 		test.Error(err)
 	}
@@ -136,7 +1849,7 @@ func TestTiming(test *testing.T) {
 	goodBlock = corruptBlockInterStates(goodBlock)
 	start := time.Now()
 	for i := 0; i < runs; i++ {
-		goodFp, err := goodBlock.CheckBlock(stateTree)
+		goodFp, err := goodBlock.CheckBlock(generateStateTree(), nil)
 		if err != nil {
 			test.Error(err)
 		} else if goodFp == nil {
@@ -148,7 +1861,7 @@ func TestTiming(test *testing.T) {
 	fmt.Println("generate proof (average): ", int64(elapsed / time.Millisecond) / int64(runs), "ms")
 
 	// verify fraud proof of bad block
-	goodFp, err := goodBlock.CheckBlock(stateTree)
+	goodFp, err := goodBlock.CheckBlock(generateStateTree(), nil)
 	start = time.Now()
 	for i := 0; i < runs; i++ {
 		ret := goodBlock.VerifyFraudProof(*goodFp)
@@ -165,6 +1878,27 @@ func TestTiming(test *testing.T) {
 // ------------------ helpers ------------------ //
 
 
+// withholdingSource serves the shares of the first rows of the data squares, and withholds the others; it may corrupt
+// the shares it serves.
+type withholdingSource struct {
+	source  ShareSource
+	rows    int
+	corrupt bool
+}
+
+func (s *withholdingSource) GetShare(blockHash []byte, row int, col int) ([]byte, [][]byte, error) {
+	if row >= s.rows && !s.corrupt {
+		return nil, nil, errors.New("share withheld")
+	}
+	share, proof, err := s.source.GetShare(blockHash, row, col)
+	if err != nil || !s.corrupt {
+		return share, proof, err
+	}
+	share = append([]byte{}, share...)
+	share[len(share)-1] ^= 1
+	return share, proof, nil
+}
+
 func generateTransactionInput() ([][]byte, [][]byte, [][]byte, [][]byte, [][]byte, []byte) {
 	var writeKeys, newData, oldData, readKeys, readData [][]byte
 
@@ -206,13 +1940,8 @@ func generateTransactionInput() ([][]byte, [][]byte, [][]byte, [][]byte, [][]byt
 		//fmt.Println(len(token), token)
 		readKeys = append(readKeys, token)
 
-		token = make([]byte, sizeData)
-		//rand.Read(token)
-		for j := 0; j < len(token); j++ {
-			token[j] = 5
-		}
-		//fmt.Println(token)
-		readData = append(readData, token)
+		// read keys are random, hence they are not in the state
+		readData = append(readData, []byte{})
 	}
 
 	return writeKeys, newData, oldData, readKeys, readData, []byte{}
@@ -229,7 +1958,7 @@ func corruptTransaction(t *Transaction) (*Transaction) {
 	return t
 }
 
-func generateBlockInput(blockSize int) ([]Transaction, *smt.SparseMerkleTree) {
+func generateBlockInput(blockSize int) ([]Transaction, *smt.SparseMerkleTree, *ChainParams, StateMachine) {
 	// average Ethereum transaction size (225B)
 	numTransactions := blockSize / 225 // 4444 transactions for 1MB block
 	t := make([]Transaction, numTransactions)
@@ -237,42 +1966,280 @@ func generateBlockInput(blockSize int) ([]Transaction, *smt.SparseMerkleTree) {
 		tmp, _ := NewTransaction(generateTransactionInput())
 		t[i] = *tmp
 	}
-	stateTree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), sha512.New512_256())
-	return t, stateTree
+	return t, generateStateTree(), DefaultChainParams(), DefaultStateMachine{}
 }
 
-func generateCorruptedBlockInput() ([]Transaction, *smt.SparseMerkleTree) {
+func generateCorruptedBlockInput() ([]Transaction, *smt.SparseMerkleTree, *ChainParams, StateMachine) {
 	t1, _ := NewTransaction(generateTransactionInput())
 	t2, _ := NewTransaction(generateTransactionInput())
 
 	t1 = corruptTransaction(t1)
 
-	stateTree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), sha512.New512_256())
-	return []Transaction{*t1,*t2}, stateTree
+	return []Transaction{*t1,*t2}, generateStateTree(), DefaultChainParams(), DefaultStateMachine{}
+}
+
+func generateCompareAndSwapTransactions(numTransactions int) []Transaction {
+	key := make([]byte, 32)
+	oldData := []byte{}
+	t := make([]Transaction, numTransactions)
+	for i := 0; i < len(t); i++ {
+		newData := []byte(fmt.Sprintf("value %d", i))
+		readKey := make([]byte, 32)
+		rand.Read(readKey)
+		tmp, _ := NewTransaction([][]byte{key}, [][]byte{newData}, [][]byte{oldData}, [][]byte{readKey}, [][]byte{{}}, []byte{})
+		t[i] = *tmp
+		oldData = newData
+	}
+	return t
+}
+
+func generateAsymmetricTransactions(numTransactions int) []Transaction {
+	t := make([]Transaction, numTransactions)
+	for i := 0; i < len(t); i++ {
+		writeKey := make([]byte, 32)
+		rand.Read(writeKey)
+		readKeys := make([][]byte, 3)
+		for j := 0; j < len(readKeys); j++ {
+			readKeys[j] = make([]byte, 32)
+			rand.Read(readKeys[j])
+		}
+		arbitrary := []byte(fmt.Sprintf("calldata %d", i))
+		tmp, _ := NewTransaction([][]byte{writeKey}, [][]byte{arbitrary}, [][]byte{{}}, readKeys, [][]byte{{}, {}, {}}, arbitrary)
+		t[i] = *tmp
+	}
+	return t
+}
+
+func generateLargeTransactions(numTransactions int, size int) []Transaction {
+	t := make([]Transaction, numTransactions)
+	for i := 0; i < len(t); i++ {
+		writeKeys, newData, oldData, readKeys, readData, arbitrary := generateTransactionInput()
+		newData[0] = make([]byte, size)
+		rand.Read(newData[0])
+		tmp, _ := NewTransaction(writeKeys, newData, oldData, readKeys, readData, arbitrary)
+		t[i] = *tmp
+	}
+	return t
+}
+
+func generateNamespacedTransactions(params *ChainParams, namespaces []byte) []Transaction {
+	t := make([]Transaction, len(namespaces))
+	for i := 0; i < len(t); i++ {
+		writeKeys, newData, oldData, readKeys, readData, arbitrary := generateTransactionInput()
+		namespace := bytes.Repeat([]byte{namespaces[i]}, params.NamespaceSize)
+		tmp, _ := NewNamespacedTransaction(namespace, writeKeys, newData, oldData, readKeys, readData, arbitrary)
+		t[i] = *tmp
+	}
+	return t
+}
+
+func setNamespace(t []Transaction, namespace []byte) []Transaction {
+	namespaced := make([]Transaction, len(t))
+	copy(namespaced, t)
+	for i := 0; i < len(namespaced); i++ {
+		namespaced[i].namespace = namespace
+	}
+	return namespaced
+}
+
+func generateStateTree() *smt.SparseMerkleTree {
+	return smt.NewSparseMerkleTree(smt.NewSimpleMap(), sha512.New512_256())
+}
+
+func corruptBlockTransactions(b *Block) (*Block) {
+	t := make([]Transaction, len(b.transactions))
+	copy(t, b.transactions)
+	t[0] = *corruptTransaction(&t[0])
+
+	chunks, square, dataRoot, _ := fillDataSquare(b.params, t, append([][]byte{b.prevStateRoot}, b.interStateRoots...))
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		dataRoot,
+		b.stateRoot,
+		b.numTransactions,
+		t,
+		nil,
+		square,
+		chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
+}
+
+func replaceBlockTransactions(b *Block, t []Transaction) (*Block) {
+	chunks, square, dataRoot, _ := fillDataSquare(b.params, t, append([][]byte{b.prevStateRoot}, b.interStateRoots...))
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		dataRoot,
+		b.stateRoot,
+		b.numTransactions,
+		t,
+		nil,
+		square,
+		chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
+}
+
+func corruptBlockChunkHeader(b *Block) (*Block) {
+	chunks := make([][]byte, len(b.chunks))
+	copy(chunks, b.chunks)
+	chunks[3] = append([]byte{}, chunks[3]...)
+	header := (chunkHeader(chunks[3]) + 1) % uint32(b.params.ChunkSize-chunkHeaderSize)
+	copy(chunks[3], makeChunkHeader(header))
+	return replaceBlockChunks(b, chunks)
+}
+
+func corruptBlockChunkSize(b *Block) (*Block) {
+	chunks := make([][]byte, len(b.chunks))
+	copy(chunks, b.chunks)
+	chunks[1] = chunks[1][:b.params.ChunkSize/2]
+	return replaceBlockChunks(b, chunks)
+}
+
+func replaceBlockChunks(b *Block, chunks [][]byte) (*Block) {
+	square, _ := newDataSquare(b.params, chunks, nil)
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		square.dataRoot(b.params),
+		b.stateRoot,
+		b.numTransactions,
+		b.transactions,
+		nil,
+		square,
+		chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
 }
 
-func generateBlockWithCorruptedTransactions() (*Block) {
-	block, _ := NewBlock(generateBlockInput(1000000))
-	t := block.transactions[0]
-	block.transactions[0] = *corruptTransaction(&t)
-	return block
+func corruptBlockErasureCoding(b *Block) (*Block) {
+	width := b.dataSquare.width
+	shares := make([][]byte, len(b.dataSquare.shares))
+	copy(shares, b.dataSquare.shares)
+	shares[width-1] = append([]byte{}, shares[width-1]...)
+	shares[width-1][0] ^= 1
+	square := &dataSquare{width, shares, make([][]byte, width), make([][]byte, width)}
+	for i := 0; i < width; i++ {
+		square.rowRoots[i] = axisRoot(b.params, i, square.row(i))
+		square.colRoots[i] = axisRoot(b.params, width+i, square.col(i))
+	}
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		square.dataRoot(b.params),
+		b.stateRoot,
+		b.numTransactions,
+		b.transactions,
+		nil,
+		square,
+		b.chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
 }
 
 func corruptBlockInterStates(b *Block) (*Block) {
+	interStateRoots := make([][]byte, len(b.interStateRoots))
+	copy(interStateRoots, b.interStateRoots)
 	h := sha512.New512_256()
 	h.Write([]byte("random"))
-	b.interStateRoots[0] = h.Sum(nil)
+	interStateRoots[0] = h.Sum(nil)
+	return replaceBlockInterStates(b, interStateRoots)
+}
 
-	dataTree := merkletree.New(sha512.New512_256())
-	dataRoot, _ := fillDataTree(b.transactions, b.interStateRoots, dataTree)
+func replaceBlockInterStates(b *Block, interStateRoots [][]byte) (*Block) {
+	chunks, square, dataRoot, _ := fillDataSquare(b.params, b.transactions, append([][]byte{b.prevStateRoot}, interStateRoots...))
 
 	return &Block{
+		b.prevHash,
+		b.height,
 		dataRoot,
 		b.stateRoot,
+		b.numTransactions,
+		b.transactions,
+		nil,
+		square,
+		chunks,
+		b.prevStateRoot,
+		interStateRoots,
+		b.params,
+		b.stateMachine}
+}
+
+func relabelBlockShare(b *Block, i int, namespaces []byte) (*Block) {
+	chunks, _, labels, _ := makeChunks(b.params, b.transactions, append([][]byte{b.prevStateRoot}, b.interStateRoots...))
+	labels[i] = namespaces
+	square, _ := newDataSquare(b.params, chunks, labels)
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		square.dataRoot(b.params),
+		b.stateRoot,
+		b.numTransactions,
 		b.transactions,
 		nil,
-		dataTree,
-		b.interStateRoots}
+		square,
+		chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
+}
+
+func replaceBlockNumTransactions(b *Block, n int) (*Block) {
+	return &Block{
+		b.prevHash,
+		b.height,
+		b.dataRoot,
+		b.stateRoot,
+		uint64(n),
+		b.transactions,
+		nil,
+		b.dataSquare,
+		b.chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
+}
+
+func corruptBlockReadData(b *Block) (*Block) {
+	t := make([]Transaction, len(b.transactions))
+	copy(t, b.transactions)
+	h := sha512.New512_256()
+	h.Write([]byte("random"))
+	t[2*b.params.Step].readData = append([][]byte{h.Sum(nil)}, t[2*b.params.Step].readData[1:]...)
+
+	chunks, square, dataRoot, _ := fillDataSquare(b.params, t, append([][]byte{b.prevStateRoot}, b.interStateRoots...))
+
+	return &Block{
+		b.prevHash,
+		b.height,
+		dataRoot,
+		b.stateRoot,
+		b.numTransactions,
+		t,
+		nil,
+		square,
+		chunks,
+		b.prevStateRoot,
+		b.interStateRoots,
+		b.params,
+		b.stateMachine}
 }
 
 func corruptFraudproofChunks(fp *FraudProof) (*FraudProof) {
@@ -294,15 +2261,21 @@ func corruptFraudproofState(fp *FraudProof) (*FraudProof) {
 // I didn't manage to make a deep copier work (.eg github.com/jinzhu/copier)
 func copyFraudproof(fp *FraudProof) (*FraudProof) {
 	copyFp := &FraudProof{
+		fp.kind, // kind
+		fp.blockHash, // blockHash
 		make([][]byte, len(fp.writeKeys)), //writeKeys
 		make([][]byte, len(fp.oldData)), //oldData
 		make([][]byte, len(fp.readKeys)), //readKeys
 		make([][]byte, len(fp.readData)), //readData
 		make([]smt.SparseCompactMerkleProof, len(fp.proofState)), //proofState
+		make([]smt.SparseCompactMerkleProof, len(fp.proofReadState)), //proofReadState
 		make([][]byte, len(fp.chunks)), // chunks
 		make([][][]byte, len(fp.proofChunks)), //proofChunks
 		make([]uint64, len(fp.chunksIndexes)), // chunksIndexes
 		fp.numOfLeaves, // numOfLeaves
+		fp.recordIndex, // recordIndex
+		fp.axisIndex, // axisIndex
+		fp.parentHeader, // parentHeader
 	}
 
 	copy(copyFp.writeKeys, fp.writeKeys)
@@ -310,6 +2283,7 @@ func copyFraudproof(fp *FraudProof) (*FraudProof) {
 	copy(copyFp.readKeys, fp.readKeys)
 	copy(copyFp.readData, fp.readData)
 	copy(copyFp.proofState, fp.proofState)
+	copy(copyFp.proofReadState, fp.proofReadState)
 	copy(copyFp.chunks, fp.chunks)
 	copy(copyFp.proofChunks, fp.proofChunks)
 	copy(copyFp.chunksIndexes, fp.chunksIndexes)
@@ -0,0 +1,90 @@
+package fraudproofs
+
+import (
+	"crypto/sha512"
+	"errors"
+)
+
+// BlockHeaderVersion is the version of the canonical block header encoding.
+const BlockHeaderVersion byte = 2
+
+// BlockHeader is the header of a block; it is all a light client needs to verify fraud proofs.
+type BlockHeader struct {
+	prevHash        []byte // hash of the previous block header
+	height          uint64
+	dataRoot        []byte // Merkle root of the row and column roots of the extended data square
+	stateRoot       []byte
+	numTransactions uint64 // number of transactions of the block, which fixes the positions of the state roots
+	numChunks       uint64 // number of chunks of the block, which fixes the width of the data square and its last chunk
+	paramsDigest    []byte // digest of the chain parameters
+}
+
+// NewBlockHeader creates a new block header.
+func NewBlockHeader(prevHash []byte, height uint64, dataRoot, stateRoot []byte, numTransactions uint64,
+	numChunks uint64, paramsDigest []byte) *BlockHeader {
+	return &BlockHeader{prevHash, height, dataRoot, stateRoot, numTransactions, numChunks, paramsDigest}
+}
+
+// PrevHash returns the hash of the previous block header, or nil for a first block.
+func (h *BlockHeader) PrevHash() []byte {
+	return h.prevHash
+}
+
+// Height returns the height of the block.
+func (h *BlockHeader) Height() uint64 {
+	return h.height
+}
+
+// Hash returns the hash of the canonical encoding of the block header.
+func (h *BlockHeader) Hash() []byte {
+	buff, _ := h.MarshalBinary()
+	hash := sha512.New512_256()
+	hash.Write(buff)
+	return hash.Sum(nil)
+}
+
+// MarshalBinary encodes the block header into its canonical encoding.
+// It starts with the version of the encoding, followed by the fields of the header; every variable-length field is
+// prefixed by its length as a little-endian uint32.
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	buff := []byte{BlockHeaderVersion}
+	buff = appendUint32(buff, len(h.prevHash))
+	buff = append(buff, h.prevHash...)
+	buff = appendUint64(buff, h.height)
+	buff = appendUint32(buff, len(h.dataRoot))
+	buff = append(buff, h.dataRoot...)
+	buff = appendUint32(buff, len(h.stateRoot))
+	buff = append(buff, h.stateRoot...)
+	buff = appendUint64(buff, h.numTransactions)
+	buff = appendUint64(buff, h.numChunks)
+	buff = appendUint32(buff, len(h.paramsDigest))
+	buff = append(buff, h.paramsDigest...)
+	return buff, nil
+}
+
+// UnmarshalBinary decodes a block header from its canonical encoding. Malformed inputs are rejected with an error.
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != BlockHeaderVersion {
+		return errors.New("unsupported block header version")
+	}
+	d := &decoder{data[1:], nil}
+	prevHash := d.bytes()
+	height := d.uint64()
+	dataRoot := d.bytes()
+	stateRoot := d.bytes()
+	numTransactions := d.uint64()
+	numChunks := d.uint64()
+	paramsDigest := d.bytes()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buff) != 0 {
+		return errors.New("trailing bytes after block header")
+	}
+	if len(prevHash) == 0 {
+		prevHash = nil
+	}
+
+	*h = BlockHeader{prevHash, height, dataRoot, stateRoot, numTransactions, numChunks, paramsDigest}
+	return nil
+}
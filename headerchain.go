@@ -0,0 +1,150 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"errors"
+)
+
+// HeaderChain is the chain of a light node: it holds a tree of block headers in which the longest chain wins. Light
+// nodes do not download the data of blocks; they admit headers through admission rules, such as data availability
+// sampling, and rely on fraud proofs from full nodes to prune the headers of invalid blocks.
+type HeaderChain struct {
+	// data structure
+	length int // length of the longest chain
+	last *BlockHeader // last header of the longest chain
+	headers map[string]*BlockHeader // headers of every branch, by hash
+
+	// implementation specific
+	params *ChainParams // parameters of the chain
+	stateMachine StateMachine // state machine of the chain, with which fraud proofs are verified
+	invalid map[string]bool // hashes of the headers shown invalid by a fraud proof
+	rules []AdmissionRule // rules a header must pass before being appended, such as data availability sampling
+}
+
+// NewHeaderChain creates an empty header chain with the given parameters and state machine.
+func NewHeaderChain(params *ChainParams, sm StateMachine) (*HeaderChain, error) {
+	err := params.CheckParams()
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderChain{
+		0,
+		nil,
+		make(map[string]*BlockHeader),
+		params,
+		sm,
+		make(map[string]bool),
+		nil}, nil
+}
+
+// AddAdmissionRule adds a rule that headers must pass before being appended; light nodes add a sampler so that they
+// only admit blocks whose data is available.
+func (hc *HeaderChain) AddAdmissionRule(rule AdmissionRule) {
+	hc.rules = append(hc.rules, rule)
+}
+
+// Append adds a header to the tree if it passes the admission rules. The header must be the one of a first block or of
+// a child of a header of the tree. If it makes a chain longer than the current one, the chain reorganizes onto it.
+func (hc *HeaderChain) Append(header *BlockHeader) error {
+	if !bytes.Equal(header.paramsDigest, hc.params.Digest()) {
+		return errors.New("the block does not use the parameters of the chain")
+	}
+	hash := header.Hash()
+	if hc.headers[string(hash)] != nil {
+		return errors.New("the block is already in the chain")
+	}
+	if hc.invalid[string(hash)] {
+		return errors.New("the block is invalid")
+	}
+	var parent *BlockHeader
+	if len(header.prevHash) != 0 {
+		parent = hc.headers[string(header.prevHash)]
+		if parent == nil && hc.invalid[string(header.prevHash)] {
+			return errors.New("the parent block is invalid")
+		}
+		if parent == nil {
+			return errors.New("the parent block is unknown")
+		}
+	}
+	if (parent == nil && header.height != 0) || (parent != nil && header.height != parent.height+1) {
+		return errors.New("the height of the block does not follow the one of its parent")
+	}
+	for _, rule := range hc.rules {
+		err := rule.Admit(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	hc.headers[string(hash)] = header
+	if int(header.height) >= hc.length {
+		hc.last, hc.length = header, int(header.height)+1
+	}
+	return nil
+}
+
+// SubmitFraudProof receives a fraud proof about a block of the tree, for example from a full node. If the fraud proof
+// checks against the header of the block, the header and the ones of its descendants are marked invalid and pruned, and
+// the chain reorganizes onto the longest remaining chain.
+func (hc *HeaderChain) SubmitFraudProof(blockHash []byte, fp FraudProof) error {
+	header, err := hc.HeaderByHash(blockHash)
+	if err != nil {
+		return err
+	}
+	if !VerifyFraudProof(header, fp, hc.params, hc.stateMachine) {
+		return errors.New("the fraud proof does not check against the block")
+	}
+
+	// 1. prune the header and its descendants
+	hc.invalid[string(blockHash)] = true
+	delete(hc.headers, string(blockHash))
+	for pruned := true; pruned; {
+		pruned = false
+		for hash, h := range hc.headers {
+			if hc.invalid[string(h.prevHash)] {
+				hc.invalid[hash] = true
+				delete(hc.headers, hash)
+				pruned = true
+			}
+		}
+	}
+
+	// 2. reorganize onto the longest remaining chain; ties are broken by the smallest header hash
+	var lastHash string
+	hc.last, hc.length = nil, 0
+	for hash, h := range hc.headers {
+		if hc.last == nil || h.height > hc.last.height || (h.height == hc.last.height && hash < lastHash) {
+			hc.last, lastHash = h, hash
+		}
+	}
+	if hc.last != nil {
+		hc.length = int(hc.last.height) + 1
+	}
+	return nil
+}
+
+// HeaderByHash returns the header of the tree with the given hash.
+func (hc *HeaderChain) HeaderByHash(hash []byte) (*BlockHeader, error) {
+	header := hc.headers[string(hash)]
+	if header == nil {
+		return nil, errors.New("unknown block")
+	}
+	return header, nil
+}
+
+// HeaderByHeight returns the header of the longest chain at the given height.
+func (hc *HeaderChain) HeaderByHeight(height uint64) (*BlockHeader, error) {
+	if height >= uint64(hc.length) {
+		return nil, errors.New("no block at this height")
+	}
+	header := hc.last
+	for header.height > height {
+		header = hc.headers[string(header.prevHash)]
+	}
+	return header, nil
+}
+
+// IsInvalid returns whether the block with the given header hash was shown invalid by a fraud proof.
+func (hc *HeaderChain) IsInvalid(hash []byte) bool {
+	return hc.invalid[string(hash)]
+}
@@ -0,0 +1,414 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"errors"
+	"math"
+)
+
+// NamespacedMerkleTree is a Merkle tree whose leaves are sorted by namespace. A leaf is the range of namespaces it
+// holds data of (its minimum and maximum namespace IDs), followed by its data; every node commits to the range of
+// namespaces below it, so that the tree can prove that a set of leaves holds all the data of a namespace.
+type NamespacedMerkleTree struct {
+	params *ChainParams
+	leaves [][]byte // hashes of the leaves
+}
+
+// NamespaceProofVersion is the version of the wire format of namespace proofs.
+const NamespaceProofVersion byte = 1
+
+// NamespaceProof proves that a range of consecutive leaves of a namespaced Merkle tree holds all the data of a
+// namespace; the range is empty if the tree holds no data of the namespace.
+type NamespaceProof struct {
+	start     int      // index of the first leaf of the range
+	end       int      // index following the last leaf of the range
+	numLeaves int      // number of leaves of the tree
+	nodes     [][]byte // roots of the subtrees on the left and on the right of the range, from left to right
+}
+
+// BlockNamespaceProof proves that a set of shares are all the shares of a block holding data of a namespace, against
+// the data root of its header. It holds the roots of the rows and columns of the data square, and the namespace proof of
+// every row whose range of namespaces starts at or before the namespace, along with the shares it proves.
+type BlockNamespaceProof struct {
+	roots  [][]byte          // row roots followed by column roots
+	shares [][][]byte        // shares holding data of the namespace, for every proven row
+	proofs []*NamespaceProof // namespace proofs of the proven rows, in order of row
+}
+
+// NewNamespacedMerkleTree creates an empty namespaced Merkle tree for the namespace IDs of the chain parameters.
+func NewNamespacedMerkleTree(params *ChainParams) (*NamespacedMerkleTree, error) {
+	if params.NamespaceSize < 1 {
+		return nil, errors.New("the chain does not use namespaces")
+	}
+	return &NamespacedMerkleTree{params, nil}, nil
+}
+
+// Push adds a leaf to the tree. Leaves must be pushed in order of namespace: the minimum namespace of a leaf cannot be
+// lower than the maximum namespace of the previous one.
+func (t *NamespacedMerkleTree) Push(leaf []byte) error {
+	hash := nmtLeafHash(t.params, leaf)
+	if hash == nil {
+		return errors.New("malformed leaf")
+	}
+	if len(t.leaves) > 0 && bytes.Compare(nmtMax(t.params, t.leaves[len(t.leaves)-1]), nmtMin(t.params, hash)) > 0 {
+		return errors.New("leaves not sorted by namespace")
+	}
+	t.leaves = append(t.leaves, hash)
+	return nil
+}
+
+// Root returns the root of the tree: the range of namespaces of its leaves followed by their digest.
+func (t *NamespacedMerkleTree) Root() []byte {
+	return nmtRoot(t.params, t.leaves, 0, len(t.leaves))
+}
+
+// ProveNamespace returns the proof that the leaves holding data of the given namespace are all the leaves of the tree
+// holding data of it, and the range of these leaves.
+func (t *NamespacedMerkleTree) ProveNamespace(namespace []byte) (*NamespaceProof, error) {
+	if len(namespace) != t.params.NamespaceSize {
+		return nil, errors.New("namespace ID of the wrong size")
+	}
+	start := 0
+	for start < len(t.leaves) && bytes.Compare(nmtMax(t.params, t.leaves[start]), namespace) < 0 {
+		start++
+	}
+	end := start
+	for end < len(t.leaves) && bytes.Compare(nmtMin(t.params, t.leaves[end]), namespace) <= 0 {
+		end++
+	}
+	return t.proveRange(start, end), nil
+}
+
+// proveRange returns the proof of the leaves from start to end (excluded).
+func (t *NamespacedMerkleTree) proveRange(start int, end int) *NamespaceProof {
+	var nodes [][]byte
+	var prove func(lo int, hi int)
+	prove = func(lo int, hi int) {
+		if hi <= start || lo >= end {
+			nodes = append(nodes, nmtRoot(t.params, t.leaves, lo, hi))
+			return
+		}
+		if hi-lo == 1 {
+			return
+		}
+		k := nmtSplit(hi - lo)
+		prove(lo, lo+k)
+		prove(lo+k, hi)
+	}
+	if len(t.leaves) > 0 {
+		prove(0, len(t.leaves))
+	}
+	return &NamespaceProof{start, end, len(t.leaves), nodes}
+}
+
+// VerifyNamespaceProof verifies that the given leaves are all the leaves holding data of the namespace in the
+// namespaced Merkle tree with the given root.
+func VerifyNamespaceProof(params *ChainParams, root []byte, namespace []byte, leaves [][]byte,
+	proof *NamespaceProof) bool {
+	if params.NamespaceSize < 1 || len(namespace) != params.NamespaceSize {
+		return false
+	}
+	for i := 0; i < len(leaves); i++ {
+		if len(leaves[i]) < 2*params.NamespaceSize {
+			return false
+		}
+		if bytes.Compare(nmtMin(params, leaves[i]), namespace) > 0 || bytes.Compare(nmtMax(params, leaves[i]), namespace) < 0 {
+			return false
+		}
+	}
+
+	// the subtrees on the left of the range end before the namespace, and the ones on its right start after it
+	complete := func(node []byte, left bool) bool {
+		if left {
+			return bytes.Compare(nmtMax(params, node), namespace) < 0
+		}
+		return bytes.Compare(nmtMin(params, node), namespace) > 0
+	}
+	return bytes.Equal(verifyRange(params, leaves, proof, complete), root)
+}
+
+// ProveNamespace returns the proof of all the shares of the block holding data of the given namespace, against the data
+// root of its header; applications verify it with VerifyBlockNamespaceProof to get the transactions of their namespace.
+func (b *Block) ProveNamespace(namespace []byte) (*BlockNamespaceProof, error) {
+	if b.params.NamespaceSize < 1 {
+		return nil, errors.New("the chain does not use namespaces")
+	}
+	if len(namespace) != b.params.NamespaceSize {
+		return nil, errors.New("namespace ID of the wrong size")
+	}
+	square := b.dataSquare
+	proof := &BlockNamespaceProof{square.roots(), nil, nil}
+	for i := 0; i < square.width; i++ {
+		if len(square.rowRoots[i]) == 0 {
+			return nil, errors.New("the data square is not sorted by namespace")
+		}
+		if bytes.Compare(nmtMin(b.params, square.rowRoots[i]), namespace) > 0 {
+			continue
+		}
+		tree, err := axisTree(b.params, i, square.row(i))
+		if err != nil {
+			return nil, err
+		}
+		rowProof, err := tree.ProveNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		proof.shares = append(proof.shares, append([][]byte{}, square.row(i)[rowProof.start:rowProof.end]...))
+		proof.proofs = append(proof.proofs, rowProof)
+	}
+	return proof, nil
+}
+
+// VerifyBlockNamespaceProof verifies that a proof generated by ProveNamespace holds all the shares of the block with the
+// given header holding data of the namespace, and returns the transactions of the namespace they hold. It fails if the
+// shares of the namespace are not consecutive chunks, or if their records do not decode to transactions.
+func VerifyBlockNamespaceProof(header *BlockHeader, params *ChainParams, namespace []byte,
+	proof *BlockNamespaceProof) ([]Transaction, bool) {
+	// 1. check the roots of the rows and columns against the data root
+	if header == nil || params == nil || proof == nil || !bytes.Equal(header.paramsDigest, params.Digest()) {
+		return nil, false
+	}
+	if params.NamespaceSize < 1 || len(namespace) != params.NamespaceSize ||
+		bytes.Equal(namespace, params.maxNamespace()) {
+		return nil, false
+	}
+	k := squareWidth(header.numChunks)
+	width := 2 * k
+	if width > maxSquareWidth || len(proof.roots) != 2*width || len(proof.shares) != len(proof.proofs) ||
+		!bytes.Equal(merkleRoot(params, proof.roots), header.dataRoot) {
+		return nil, false
+	}
+
+	// 2. check the namespace proof of every row whose range of namespaces starts at or before the namespace, and
+	// collect the chunks held by the proven shares
+	var chunks [][]byte
+	row, next := 0, -1
+	for i := 0; i < width; i++ {
+		root := proof.roots[i]
+		if len(root) < 2*params.NamespaceSize || bytes.Compare(nmtMin(params, root), namespace) > 0 {
+			continue
+		}
+		if row >= len(proof.proofs) || proof.proofs[row] == nil || proof.proofs[row].numLeaves != width {
+			return nil, false
+		}
+		rowProof, shares := proof.proofs[row], proof.shares[row]
+		row++
+		leaves := make([][]byte, len(shares))
+		for j := 0; j < len(shares); j++ {
+			leaves[j] = axisLeaf(params, shares[j], i, rowProof.start+j, width)
+		}
+		if !VerifyNamespaceProof(params, root, namespace, leaves, rowProof) {
+			return nil, false
+		}
+		for j := 0; j < len(shares); j++ {
+			index := i*k + rowProof.start + j
+			chunk := shareChunk(params, shares[j])
+			if (next >= 0 && index != next) || uint64(index) >= header.numChunks || chunk == nil {
+				return nil, false
+			}
+			chunks, next = append(chunks, chunk), index+1
+		}
+	}
+	if row != len(proof.proofs) {
+		return nil, false
+	}
+
+	// 3. decode the transactions of the namespace from the records starting in the chunks
+	var t []Transaction
+	if len(chunks) == 0 {
+		return t, true
+	}
+	records, _ := chunkRecords(params, chunks, 0)
+	if len(records) == 0 {
+		return nil, false
+	}
+	for _, record := range records {
+		if isStateRootRecord(record) {
+			continue
+		}
+		tx, err := Deserialize(record)
+		if err != nil {
+			return nil, false
+		}
+		if bytes.Equal(tx.namespace, namespace) {
+			t = append(t, *tx)
+		}
+	}
+	return t, true
+}
+
+// MarshalBinary encodes the namespace proof into its wire format: the version, the range of leaves and the number of
+// leaves as little-endian uint64, and the nodes as a length-prefixed list.
+func (p *NamespaceProof) MarshalBinary() ([]byte, error) {
+	return appendNamespaceProof([]byte{NamespaceProofVersion}, p), nil
+}
+
+// UnmarshalBinary decodes a namespace proof from its wire format. Malformed inputs are rejected with an error.
+func (p *NamespaceProof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != NamespaceProofVersion {
+		return errors.New("unsupported namespace proof version")
+	}
+	d := &decoder{data[1:], nil}
+	proof := d.namespaceProof()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buff) != 0 {
+		return errors.New("trailing bytes after namespace proof")
+	}
+	*p = *proof
+	return nil
+}
+
+// MarshalBinary encodes the block namespace proof into its wire format: the version, the roots of the rows and columns,
+// and the number of proven rows followed by the shares and the namespace proof of every row.
+func (p *BlockNamespaceProof) MarshalBinary() ([]byte, error) {
+	buff := []byte{NamespaceProofVersion}
+	buff = appendBytesList(buff, p.roots)
+	buff = appendUint32(buff, len(p.proofs))
+	for i := 0; i < len(p.proofs); i++ {
+		buff = appendBytesList(buff, p.shares[i])
+		buff = appendNamespaceProof(buff, p.proofs[i])
+	}
+	return buff, nil
+}
+
+// UnmarshalBinary decodes a block namespace proof from its wire format. Malformed inputs are rejected with an error.
+func (p *BlockNamespaceProof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != NamespaceProofVersion {
+		return errors.New("unsupported namespace proof version")
+	}
+	d := &decoder{data[1:], nil}
+	roots := d.bytesList()
+	numRows := d.count(32)
+	shares := make([][][]byte, numRows)
+	proofs := make([]*NamespaceProof, numRows)
+	for i := 0; i < numRows; i++ {
+		shares[i] = d.bytesList()
+		proofs[i] = d.namespaceProof()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buff) != 0 {
+		return errors.New("trailing bytes after namespace proof")
+	}
+	*p = BlockNamespaceProof{roots, shares, proofs}
+	return nil
+}
+
+// appendNamespaceProof appends the fields of a namespace proof to the buffer.
+func appendNamespaceProof(buff []byte, p *NamespaceProof) []byte {
+	buff = appendUint64(buff, uint64(p.start))
+	buff = appendUint64(buff, uint64(p.end))
+	buff = appendUint64(buff, uint64(p.numLeaves))
+	return appendBytesList(buff, p.nodes)
+}
+
+// namespaceProof reads the fields of a namespace proof; the range and the number of leaves must fit in an int32.
+func (d *decoder) namespaceProof() *NamespaceProof {
+	start, end, numLeaves := d.uint64(), d.uint64(), d.uint64()
+	nodes := d.bytesList()
+	if d.err == nil && (start > math.MaxInt32 || end > math.MaxInt32 || numLeaves > math.MaxInt32) {
+		d.err = errors.New("namespace proof range out of bounds")
+	}
+	return &NamespaceProof{int(start), int(end), int(numLeaves), nodes}
+}
+
+// verifyRange returns the root of a namespaced Merkle tree computed from the proof of a range of leaves, or nil if the
+// proof is malformed or if a subtree outside of the range does not pass the given check.
+func verifyRange(params *ChainParams, leaves [][]byte, proof *NamespaceProof, check func([]byte, bool) bool) []byte {
+	if proof.start < 0 || proof.start > proof.end || proof.end > proof.numLeaves || proof.numLeaves < 1 ||
+		len(leaves) != proof.end-proof.start {
+		return nil
+	}
+	next := 0
+	var compute func(lo int, hi int) []byte
+	compute = func(lo int, hi int) []byte {
+		if hi <= proof.start || lo >= proof.end {
+			if next >= len(proof.nodes) || len(proof.nodes[next]) < 2*params.NamespaceSize ||
+				!check(proof.nodes[next], hi <= proof.start) {
+				return nil
+			}
+			next++
+			return proof.nodes[next-1]
+		}
+		if hi-lo == 1 {
+			return nmtLeafHash(params, leaves[lo-proof.start])
+		}
+		k := nmtSplit(hi - lo)
+		left := compute(lo, lo+k)
+		right := compute(lo+k, hi)
+		if left == nil || right == nil {
+			return nil
+		}
+		return nmtNodeHash(params, left, right)
+	}
+	root := compute(0, proof.numLeaves)
+	if next != len(proof.nodes) {
+		return nil
+	}
+	return root
+}
+
+// nmtRoot returns the root of the subtree over the leaf hashes from lo to hi (excluded), or nil if the leaves are not
+// sorted by namespace.
+func nmtRoot(params *ChainParams, leaves [][]byte, lo int, hi int) []byte {
+	if hi-lo == 0 {
+		h := params.Hash()
+		return append(make([]byte, 2*params.NamespaceSize), h.Sum(nil)...)
+	}
+	if hi-lo == 1 {
+		return leaves[lo]
+	}
+	k := nmtSplit(hi - lo)
+	left, right := nmtRoot(params, leaves, lo, lo+k), nmtRoot(params, leaves, lo+k, hi)
+	if left == nil || right == nil {
+		return nil
+	}
+	return nmtNodeHash(params, left, right)
+}
+
+// nmtSplit returns the number of leaves of the left subtree of a tree with n > 1 leaves: the largest power of two
+// lower than n.
+func nmtSplit(n int) int {
+	k := 1
+	for 2*k < n {
+		k *= 2
+	}
+	return k
+}
+
+// nmtLeafHash returns the hash of a leaf, or nil if the leaf is malformed.
+func nmtLeafHash(params *ChainParams, leaf []byte) []byte {
+	if len(leaf) < 2*params.NamespaceSize || bytes.Compare(nmtMin(params, leaf), nmtMax(params, leaf)) > 0 {
+		return nil
+	}
+	h := params.Hash()
+	h.Write([]byte{0})
+	h.Write(leaf)
+	return append(append([]byte{}, leaf[:2*params.NamespaceSize]...), h.Sum(nil)...)
+}
+
+// nmtNodeHash returns the hash of a node given the hashes of its children, or nil if the children are not sorted by
+// namespace.
+func nmtNodeHash(params *ChainParams, left []byte, right []byte) []byte {
+	if bytes.Compare(nmtMax(params, left), nmtMin(params, right)) > 0 {
+		return nil
+	}
+	h := params.Hash()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return append(append(append([]byte{}, nmtMin(params, left)...), nmtMax(params, right)...), h.Sum(nil)...)
+}
+
+// nmtMin returns the minimum namespace ID of a leaf or node.
+func nmtMin(params *ChainParams, node []byte) []byte {
+	return node[:params.NamespaceSize]
+}
+
+// nmtMax returns the maximum namespace ID of a leaf or node.
+func nmtMax(params *ChainParams, node []byte) []byte {
+	return node[params.NamespaceSize : 2*params.NamespaceSize]
+}
@@ -0,0 +1,172 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"github.com/lazyledger/smt"
+	"hash"
+)
+
+// ChainParams are the parameters of a chain; they let deployments trade the size of fraud proofs against the overhead
+// of blocks.
+type ChainParams struct {
+	Step               int              // interval on which to compute intermediate state roots (must be a positive integer)
+	ChunkSize          int              // size of each chunk, including its header; blocks hold at most MaxChunks chunks
+	Hash               func() hash.Hash // hash function of the data square and of the state tree
+	MaxTransactionSize int              // maximum size of a serialized transaction
+	NamespaceSize      int              // size of namespace IDs, or 0 to commit the data with plain Merkle trees
+}
+
+// DefaultChainParams returns the default chain parameters.
+func DefaultChainParams() *ChainParams {
+	return &ChainParams{2, 256, sha512.New512_256, 1 << 20, 0}
+}
+
+// CheckParams verifies whether the chain parameters are valid.
+func (p *ChainParams) CheckParams() error {
+	if p.Step < 1 {
+		return errors.New("step should be a positive integer")
+	}
+	if p.ChunkSize <= chunkHeaderSize || uint64(p.ChunkSize-chunkHeaderSize) >= uint64(noRecordStart) {
+		return errors.New("chunk size should hold a chunk header and some data")
+	}
+	if p.Hash == nil {
+		return errors.New("missing hash function")
+	}
+	if p.MaxTransactionSize < 1 {
+		return errors.New("maximum transaction size should be a positive integer")
+	}
+	if p.NamespaceSize < 0 {
+		return errors.New("namespace size should not be negative")
+	}
+	return nil
+}
+
+// Digest returns a digest committing to the chain parameters; block headers commit to it. The hash function is
+// identified by its digest of the empty input.
+func (p *ChainParams) Digest() []byte {
+	buff := appendUint64(nil, uint64(p.Step))
+	buff = appendUint64(buff, uint64(p.ChunkSize))
+	buff = appendUint64(buff, uint64(p.MaxTransactionSize))
+	buff = appendUint64(buff, uint64(p.NamespaceSize))
+	buff = append(buff, p.Hash().Sum(nil)...)
+
+	hash := sha512.New512_256()
+	hash.Write(buff)
+	return hash.Sum(nil)
+}
+
+// stateRootSize returns the size of a state root.
+func (p *ChainParams) stateRootSize() int {
+	return p.Hash().Size()
+}
+
+// emptyStateRoot returns the root of the empty state, on top of which first blocks are applied.
+func (p *ChainParams) emptyStateRoot() []byte {
+	return smt.NewSparseMerkleTree(smt.NewSimpleMap(), p.Hash()).Root()
+}
+
+// namespaceID returns the namespace ID of a transaction, when the chain uses namespaces: its namespace, padded with
+// zeros or truncated to the namespace size, so that blocks holding malformed namespaces can still be committed.
+func (p *ChainParams) namespaceID(t *Transaction) []byte {
+	namespace := make([]byte, p.NamespaceSize)
+	copy(namespace, t.namespace)
+	return namespace
+}
+
+// checkTransaction verifies whether a transaction can be included in a block of the chain: it must be well-formed, fit
+// in the maximum transaction size, and have a namespace ID of the namespace size other than the reserved largest one.
+func (p *ChainParams) checkTransaction(t *Transaction) error {
+	err := t.CheckTransaction()
+	if err != nil {
+		return err
+	}
+	if len(t.Serialize()) > p.MaxTransactionSize {
+		return errors.New("transaction larger than the maximum transaction size")
+	}
+	if len(t.namespace) != p.NamespaceSize {
+		return errors.New("namespace ID of the wrong size")
+	}
+	if p.NamespaceSize > 0 && bytes.Equal(t.namespace, p.maxNamespace()) {
+		return errors.New("the largest namespace ID is reserved")
+	}
+	return nil
+}
+
+// maxNamespace returns the largest namespace ID, which is the namespace of the padding and parity shares of the data
+// square.
+func (p *ChainParams) maxNamespace() []byte {
+	return bytes.Repeat([]byte{0xff}, p.NamespaceSize)
+}
+
+// numOfWindows returns the number of windows of (at most) 'Step' transactions of a block with n transactions; each
+// window is followed by an intermediate state root.
+func (p *ChainParams) numOfWindows(n int) int {
+	return (n + p.Step - 1) / p.Step
+}
+
+// lastWindowSize returns the number of transactions of the last window of a block with n transactions.
+func (p *ChainParams) lastWindowSize(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return n - (p.numOfWindows(n)-1)*p.Step
+}
+
+// getWindow returns the i-th window of transactions.
+func (p *ChainParams) getWindow(t []Transaction, i int) []Transaction {
+	t = t[i*p.Step:]
+	if len(t) > p.Step {
+		t = t[:p.Step]
+	}
+	return t
+}
+
+// rootRecordIndex returns the index of the record holding the k-th state root in the serialized data of a block with
+// n transactions.
+func (p *ChainParams) rootRecordIndex(k int, n int) int {
+	if k*p.Step > n {
+		return n + k
+	}
+	return k*p.Step + k
+}
+
+// transactionRecordIndex returns the index of the record holding the i-th transaction in the serialized data of a
+// block.
+func (p *ChainParams) transactionRecordIndex(i int) int {
+	return i + i/p.Step + 1
+}
+
+// recordLength returns the length of the record at the beginning of the serialized block data, and whether its length
+// prefix can be read. Lengths running past the end of the data are capped just after it.
+func (p *ChainParams) recordLength(buff []byte) (int, bool) {
+	length, n := binary.Uvarint(buff)
+	if n <= 0 {
+		return 0, false
+	}
+	if length == 0 {
+		return n + rootIndexSize + p.stateRootSize(), true
+	}
+	if length > uint64(len(buff)-n) {
+		return len(buff) + 1, true
+	}
+	return n + int(length), true
+}
+
+// chunkRange returns the first and the last chunks holding the serialized data from the byte offset start to the byte
+// offset end (excluded); the range must not be empty.
+func (p *ChainParams) chunkRange(start int, end int) (int, int) {
+	size := p.ChunkSize - chunkHeaderSize
+	return start / size, (end - 1) / size
+}
+
+// checkChunkSize returns whether the i-th chunk of a block with n chunks has a valid size: every chunk is full
+// except the last one, and every chunk holds some data.
+func (p *ChainParams) checkChunkSize(chunk []byte, i uint64, n uint64) bool {
+	if i == n-1 {
+		return len(chunk) > chunkHeaderSize && len(chunk) <= p.ChunkSize
+	}
+	return len(chunk) == p.ChunkSize
+}
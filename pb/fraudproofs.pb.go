@@ -0,0 +1,670 @@
+// Protocol buffers of the transactions, blocks and fraud proofs of the fraudproofs package, so that clients in other
+// languages can check fraud proofs. Regenerate fraudproofs.pb.go with:
+//   protoc --go_out=. --go_opt=paths=source_relative fraudproofs.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: fraudproofs.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Kind is the kind of fraud shown by the fraud proof.
+type FraudProof_Kind int32
+
+const (
+	FraudProof_STATE_TRANSITION    FraudProof_Kind = 0
+	FraudProof_INVALID_TRANSACTION FraudProof_Kind = 1
+	FraudProof_BAD_ENCODING        FraudProof_Kind = 2
+	FraudProof_MISSING_STATE_ROOT  FraudProof_Kind = 3
+	FraudProof_EXTRA_STATE_ROOT    FraudProof_Kind = 4
+	FraudProof_BAD_ERASURE_CODING  FraudProof_Kind = 5
+	FraudProof_HEADER_STATE_ROOT   FraudProof_Kind = 6
+	FraudProof_PARENT_STATE_ROOT   FraudProof_Kind = 7
+	FraudProof_MISLABELLED_SHARE   FraudProof_Kind = 8
+	FraudProof_UNSORTED_NAMESPACE  FraudProof_Kind = 9
+)
+
+// Enum value maps for FraudProof_Kind.
+var (
+	FraudProof_Kind_name = map[int32]string{
+		0: "STATE_TRANSITION",
+		1: "INVALID_TRANSACTION",
+		2: "BAD_ENCODING",
+		3: "MISSING_STATE_ROOT",
+		4: "EXTRA_STATE_ROOT",
+		5: "BAD_ERASURE_CODING",
+		6: "HEADER_STATE_ROOT",
+		7: "PARENT_STATE_ROOT",
+		8: "MISLABELLED_SHARE",
+		9: "UNSORTED_NAMESPACE",
+	}
+	FraudProof_Kind_value = map[string]int32{
+		"STATE_TRANSITION":    0,
+		"INVALID_TRANSACTION": 1,
+		"BAD_ENCODING":        2,
+		"MISSING_STATE_ROOT":  3,
+		"EXTRA_STATE_ROOT":    4,
+		"BAD_ERASURE_CODING":  5,
+		"HEADER_STATE_ROOT":   6,
+		"PARENT_STATE_ROOT":   7,
+		"MISLABELLED_SHARE":   8,
+		"UNSORTED_NAMESPACE":  9,
+	}
+)
+
+func (x FraudProof_Kind) Enum() *FraudProof_Kind {
+	p := new(FraudProof_Kind)
+	*p = x
+	return p
+}
+
+func (x FraudProof_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FraudProof_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_fraudproofs_proto_enumTypes[0].Descriptor()
+}
+
+func (FraudProof_Kind) Type() protoreflect.EnumType {
+	return &file_fraudproofs_proto_enumTypes[0]
+}
+
+func (x FraudProof_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FraudProof_Kind.Descriptor instead.
+func (FraudProof_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{4, 0}
+}
+
+// Transaction is a transaction of the blockchain.
+type Transaction struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	WriteKeys     [][]byte               `protobuf:"bytes,1,rep,name=write_keys,json=writeKeys,proto3" json:"write_keys,omitempty"`
+	NewData       [][]byte               `protobuf:"bytes,2,rep,name=new_data,json=newData,proto3" json:"new_data,omitempty"`
+	OldData       [][]byte               `protobuf:"bytes,3,rep,name=old_data,json=oldData,proto3" json:"old_data,omitempty"`
+	ReadKeys      [][]byte               `protobuf:"bytes,4,rep,name=read_keys,json=readKeys,proto3" json:"read_keys,omitempty"`
+	ReadData      [][]byte               `protobuf:"bytes,5,rep,name=read_data,json=readData,proto3" json:"read_data,omitempty"`
+	Arbitrary     []byte                 `protobuf:"bytes,6,opt,name=arbitrary,proto3" json:"arbitrary,omitempty"`
+	Namespace     []byte                 `protobuf:"bytes,7,opt,name=namespace,proto3" json:"namespace,omitempty"` // namespace ID, empty if the chain does not use namespaces
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Transaction) Reset() {
+	*x = Transaction{}
+	mi := &file_fraudproofs_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Transaction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transaction) ProtoMessage() {}
+
+func (x *Transaction) ProtoReflect() protoreflect.Message {
+	mi := &file_fraudproofs_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transaction.ProtoReflect.Descriptor instead.
+func (*Transaction) Descriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Transaction) GetWriteKeys() [][]byte {
+	if x != nil {
+		return x.WriteKeys
+	}
+	return nil
+}
+
+func (x *Transaction) GetNewData() [][]byte {
+	if x != nil {
+		return x.NewData
+	}
+	return nil
+}
+
+func (x *Transaction) GetOldData() [][]byte {
+	if x != nil {
+		return x.OldData
+	}
+	return nil
+}
+
+func (x *Transaction) GetReadKeys() [][]byte {
+	if x != nil {
+		return x.ReadKeys
+	}
+	return nil
+}
+
+func (x *Transaction) GetReadData() [][]byte {
+	if x != nil {
+		return x.ReadData
+	}
+	return nil
+}
+
+func (x *Transaction) GetArbitrary() []byte {
+	if x != nil {
+		return x.Arbitrary
+	}
+	return nil
+}
+
+func (x *Transaction) GetNamespace() []byte {
+	if x != nil {
+		return x.Namespace
+	}
+	return nil
+}
+
+// BlockHeader is the header of a block; it is all a light client needs to verify fraud proofs.
+type BlockHeader struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	PrevHash        []byte                 `protobuf:"bytes,1,opt,name=prev_hash,json=prevHash,proto3" json:"prev_hash,omitempty"`
+	Height          uint64                 `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	DataRoot        []byte                 `protobuf:"bytes,3,opt,name=data_root,json=dataRoot,proto3" json:"data_root,omitempty"`
+	StateRoot       []byte                 `protobuf:"bytes,4,opt,name=state_root,json=stateRoot,proto3" json:"state_root,omitempty"`
+	NumTransactions uint64                 `protobuf:"varint,5,opt,name=num_transactions,json=numTransactions,proto3" json:"num_transactions,omitempty"`
+	ParamsDigest    []byte                 `protobuf:"bytes,6,opt,name=params_digest,json=paramsDigest,proto3" json:"params_digest,omitempty"`
+	NumChunks       uint64                 `protobuf:"varint,7,opt,name=num_chunks,json=numChunks,proto3" json:"num_chunks,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BlockHeader) Reset() {
+	*x = BlockHeader{}
+	mi := &file_fraudproofs_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockHeader) ProtoMessage() {}
+
+func (x *BlockHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_fraudproofs_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockHeader.ProtoReflect.Descriptor instead.
+func (*BlockHeader) Descriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BlockHeader) GetPrevHash() []byte {
+	if x != nil {
+		return x.PrevHash
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetHeight() uint64 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetDataRoot() []byte {
+	if x != nil {
+		return x.DataRoot
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetStateRoot() []byte {
+	if x != nil {
+		return x.StateRoot
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetNumTransactions() uint64 {
+	if x != nil {
+		return x.NumTransactions
+	}
+	return 0
+}
+
+func (x *BlockHeader) GetParamsDigest() []byte {
+	if x != nil {
+		return x.ParamsDigest
+	}
+	return nil
+}
+
+func (x *BlockHeader) GetNumChunks() uint64 {
+	if x != nil {
+		return x.NumChunks
+	}
+	return 0
+}
+
+// BlockBody is the body of a block: its transactions and the state roots committed in its data.
+type BlockBody struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Transactions    []*Transaction         `protobuf:"bytes,1,rep,name=transactions,proto3" json:"transactions,omitempty"`
+	PrevStateRoot   []byte                 `protobuf:"bytes,2,opt,name=prev_state_root,json=prevStateRoot,proto3" json:"prev_state_root,omitempty"`
+	InterStateRoots [][]byte               `protobuf:"bytes,3,rep,name=inter_state_roots,json=interStateRoots,proto3" json:"inter_state_roots,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BlockBody) Reset() {
+	*x = BlockBody{}
+	mi := &file_fraudproofs_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockBody) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockBody) ProtoMessage() {}
+
+func (x *BlockBody) ProtoReflect() protoreflect.Message {
+	mi := &file_fraudproofs_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockBody.ProtoReflect.Descriptor instead.
+func (*BlockBody) Descriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BlockBody) GetTransactions() []*Transaction {
+	if x != nil {
+		return x.Transactions
+	}
+	return nil
+}
+
+func (x *BlockBody) GetPrevStateRoot() []byte {
+	if x != nil {
+		return x.PrevStateRoot
+	}
+	return nil
+}
+
+func (x *BlockBody) GetInterStateRoots() [][]byte {
+	if x != nil {
+		return x.InterStateRoots
+	}
+	return nil
+}
+
+// BytesList is a list of byte arrays, such as a Merkle proof.
+type BytesList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         [][]byte               `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BytesList) Reset() {
+	*x = BytesList{}
+	mi := &file_fraudproofs_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BytesList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BytesList) ProtoMessage() {}
+
+func (x *BytesList) ProtoReflect() protoreflect.Message {
+	mi := &file_fraudproofs_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BytesList.ProtoReflect.Descriptor instead.
+func (*BytesList) Descriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BytesList) GetItems() [][]byte {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+// FraudProof is a fraud proof. Fields that are not used by its kind are empty.
+type FraudProof struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Kind           FraudProof_Kind        `protobuf:"varint,1,opt,name=kind,proto3,enum=fraudproofs.FraudProof_Kind" json:"kind,omitempty"`
+	WriteKeys      [][]byte               `protobuf:"bytes,2,rep,name=write_keys,json=writeKeys,proto3" json:"write_keys,omitempty"`
+	OldData        [][]byte               `protobuf:"bytes,3,rep,name=old_data,json=oldData,proto3" json:"old_data,omitempty"`
+	ReadKeys       [][]byte               `protobuf:"bytes,4,rep,name=read_keys,json=readKeys,proto3" json:"read_keys,omitempty"`
+	ReadData       [][]byte               `protobuf:"bytes,5,rep,name=read_data,json=readData,proto3" json:"read_data,omitempty"`
+	ProofState     []*BytesList           `protobuf:"bytes,6,rep,name=proof_state,json=proofState,proto3" json:"proof_state,omitempty"`
+	ProofReadState []*BytesList           `protobuf:"bytes,7,rep,name=proof_read_state,json=proofReadState,proto3" json:"proof_read_state,omitempty"`
+	Chunks         [][]byte               `protobuf:"bytes,8,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	ProofChunks    []*BytesList           `protobuf:"bytes,9,rep,name=proof_chunks,json=proofChunks,proto3" json:"proof_chunks,omitempty"`
+	ChunksIndexes  []uint64               `protobuf:"varint,10,rep,packed,name=chunks_indexes,json=chunksIndexes,proto3" json:"chunks_indexes,omitempty"`
+	NumOfLeaves    uint64                 `protobuf:"varint,11,opt,name=num_of_leaves,json=numOfLeaves,proto3" json:"num_of_leaves,omitempty"`
+	RecordIndex    uint64                 `protobuf:"varint,12,opt,name=record_index,json=recordIndex,proto3" json:"record_index,omitempty"`   // index of the first proven record among the records starting in the first chunk
+	BlockHash      []byte                 `protobuf:"bytes,13,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`          // hash of the header of the accused block
+	AxisIndex      uint64                 `protobuf:"varint,14,opt,name=axis_index,json=axisIndex,proto3" json:"axis_index,omitempty"`         // axis of the accused row or column of the data square
+	ParentHeader   []byte                 `protobuf:"bytes,15,opt,name=parent_header,json=parentHeader,proto3" json:"parent_header,omitempty"` // canonical encoding of the header of the parent of the accused block
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FraudProof) Reset() {
+	*x = FraudProof{}
+	mi := &file_fraudproofs_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FraudProof) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FraudProof) ProtoMessage() {}
+
+func (x *FraudProof) ProtoReflect() protoreflect.Message {
+	mi := &file_fraudproofs_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FraudProof.ProtoReflect.Descriptor instead.
+func (*FraudProof) Descriptor() ([]byte, []int) {
+	return file_fraudproofs_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FraudProof) GetKind() FraudProof_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return FraudProof_STATE_TRANSITION
+}
+
+func (x *FraudProof) GetWriteKeys() [][]byte {
+	if x != nil {
+		return x.WriteKeys
+	}
+	return nil
+}
+
+func (x *FraudProof) GetOldData() [][]byte {
+	if x != nil {
+		return x.OldData
+	}
+	return nil
+}
+
+func (x *FraudProof) GetReadKeys() [][]byte {
+	if x != nil {
+		return x.ReadKeys
+	}
+	return nil
+}
+
+func (x *FraudProof) GetReadData() [][]byte {
+	if x != nil {
+		return x.ReadData
+	}
+	return nil
+}
+
+func (x *FraudProof) GetProofState() []*BytesList {
+	if x != nil {
+		return x.ProofState
+	}
+	return nil
+}
+
+func (x *FraudProof) GetProofReadState() []*BytesList {
+	if x != nil {
+		return x.ProofReadState
+	}
+	return nil
+}
+
+func (x *FraudProof) GetChunks() [][]byte {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+func (x *FraudProof) GetProofChunks() []*BytesList {
+	if x != nil {
+		return x.ProofChunks
+	}
+	return nil
+}
+
+func (x *FraudProof) GetChunksIndexes() []uint64 {
+	if x != nil {
+		return x.ChunksIndexes
+	}
+	return nil
+}
+
+func (x *FraudProof) GetNumOfLeaves() uint64 {
+	if x != nil {
+		return x.NumOfLeaves
+	}
+	return 0
+}
+
+func (x *FraudProof) GetRecordIndex() uint64 {
+	if x != nil {
+		return x.RecordIndex
+	}
+	return 0
+}
+
+func (x *FraudProof) GetBlockHash() []byte {
+	if x != nil {
+		return x.BlockHash
+	}
+	return nil
+}
+
+func (x *FraudProof) GetAxisIndex() uint64 {
+	if x != nil {
+		return x.AxisIndex
+	}
+	return 0
+}
+
+func (x *FraudProof) GetParentHeader() []byte {
+	if x != nil {
+		return x.ParentHeader
+	}
+	return nil
+}
+
+var File_fraudproofs_proto protoreflect.FileDescriptor
+
+const file_fraudproofs_proto_rawDesc = "" +
+	"\n" +
+	"\x11fraudproofs.proto\x12\vfraudproofs\"\xd8\x01\n" +
+	"\vTransaction\x12\x1d\n" +
+	"\n" +
+	"write_keys\x18\x01 \x03(\fR\twriteKeys\x12\x19\n" +
+	"\bnew_data\x18\x02 \x03(\fR\anewData\x12\x19\n" +
+	"\bold_data\x18\x03 \x03(\fR\aoldData\x12\x1b\n" +
+	"\tread_keys\x18\x04 \x03(\fR\breadKeys\x12\x1b\n" +
+	"\tread_data\x18\x05 \x03(\fR\breadData\x12\x1c\n" +
+	"\tarbitrary\x18\x06 \x01(\fR\tarbitrary\x12\x1c\n" +
+	"\tnamespace\x18\a \x01(\fR\tnamespace\"\xed\x01\n" +
+	"\vBlockHeader\x12\x1b\n" +
+	"\tprev_hash\x18\x01 \x01(\fR\bprevHash\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x04R\x06height\x12\x1b\n" +
+	"\tdata_root\x18\x03 \x01(\fR\bdataRoot\x12\x1d\n" +
+	"\n" +
+	"state_root\x18\x04 \x01(\fR\tstateRoot\x12)\n" +
+	"\x10num_transactions\x18\x05 \x01(\x04R\x0fnumTransactions\x12#\n" +
+	"\rparams_digest\x18\x06 \x01(\fR\fparamsDigest\x12\x1d\n" +
+	"\n" +
+	"num_chunks\x18\a \x01(\x04R\tnumChunks\"\x9d\x01\n" +
+	"\tBlockBody\x12<\n" +
+	"\ftransactions\x18\x01 \x03(\v2\x18.fraudproofs.TransactionR\ftransactions\x12&\n" +
+	"\x0fprev_state_root\x18\x02 \x01(\fR\rprevStateRoot\x12*\n" +
+	"\x11inter_state_roots\x18\x03 \x03(\fR\x0finterStateRoots\"!\n" +
+	"\tBytesList\x12\x14\n" +
+	"\x05items\x18\x01 \x03(\fR\x05items\"\xbe\x06\n" +
+	"\n" +
+	"FraudProof\x120\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x1c.fraudproofs.FraudProof.KindR\x04kind\x12\x1d\n" +
+	"\n" +
+	"write_keys\x18\x02 \x03(\fR\twriteKeys\x12\x19\n" +
+	"\bold_data\x18\x03 \x03(\fR\aoldData\x12\x1b\n" +
+	"\tread_keys\x18\x04 \x03(\fR\breadKeys\x12\x1b\n" +
+	"\tread_data\x18\x05 \x03(\fR\breadData\x127\n" +
+	"\vproof_state\x18\x06 \x03(\v2\x16.fraudproofs.BytesListR\n" +
+	"proofState\x12@\n" +
+	"\x10proof_read_state\x18\a \x03(\v2\x16.fraudproofs.BytesListR\x0eproofReadState\x12\x16\n" +
+	"\x06chunks\x18\b \x03(\fR\x06chunks\x129\n" +
+	"\fproof_chunks\x18\t \x03(\v2\x16.fraudproofs.BytesListR\vproofChunks\x12%\n" +
+	"\x0echunks_indexes\x18\n" +
+	" \x03(\x04R\rchunksIndexes\x12\"\n" +
+	"\rnum_of_leaves\x18\v \x01(\x04R\vnumOfLeaves\x12!\n" +
+	"\frecord_index\x18\f \x01(\x04R\vrecordIndex\x12\x1d\n" +
+	"\n" +
+	"block_hash\x18\r \x01(\fR\tblockHash\x12\x1d\n" +
+	"\n" +
+	"axis_index\x18\x0e \x01(\x04R\taxisIndex\x12#\n" +
+	"\rparent_header\x18\x0f \x01(\fR\fparentHeader\"\xea\x01\n" +
+	"\x04Kind\x12\x14\n" +
+	"\x10STATE_TRANSITION\x10\x00\x12\x17\n" +
+	"\x13INVALID_TRANSACTION\x10\x01\x12\x10\n" +
+	"\fBAD_ENCODING\x10\x02\x12\x16\n" +
+	"\x12MISSING_STATE_ROOT\x10\x03\x12\x14\n" +
+	"\x10EXTRA_STATE_ROOT\x10\x04\x12\x16\n" +
+	"\x12BAD_ERASURE_CODING\x10\x05\x12\x15\n" +
+	"\x11HEADER_STATE_ROOT\x10\x06\x12\x15\n" +
+	"\x11PARENT_STATE_ROOT\x10\a\x12\x15\n" +
+	"\x11MISLABELLED_SHARE\x10\b\x12\x16\n" +
+	"\x12UNSORTED_NAMESPACE\x10\tB.Z,github.com/asonnino/fraudproofs-prototype/pbb\x06proto3"
+
+var (
+	file_fraudproofs_proto_rawDescOnce sync.Once
+	file_fraudproofs_proto_rawDescData []byte
+)
+
+func file_fraudproofs_proto_rawDescGZIP() []byte {
+	file_fraudproofs_proto_rawDescOnce.Do(func() {
+		file_fraudproofs_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_fraudproofs_proto_rawDesc), len(file_fraudproofs_proto_rawDesc)))
+	})
+	return file_fraudproofs_proto_rawDescData
+}
+
+var file_fraudproofs_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_fraudproofs_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_fraudproofs_proto_goTypes = []any{
+	(FraudProof_Kind)(0), // 0: fraudproofs.FraudProof.Kind
+	(*Transaction)(nil),  // 1: fraudproofs.Transaction
+	(*BlockHeader)(nil),  // 2: fraudproofs.BlockHeader
+	(*BlockBody)(nil),    // 3: fraudproofs.BlockBody
+	(*BytesList)(nil),    // 4: fraudproofs.BytesList
+	(*FraudProof)(nil),   // 5: fraudproofs.FraudProof
+}
+var file_fraudproofs_proto_depIdxs = []int32{
+	1, // 0: fraudproofs.BlockBody.transactions:type_name -> fraudproofs.Transaction
+	0, // 1: fraudproofs.FraudProof.kind:type_name -> fraudproofs.FraudProof.Kind
+	4, // 2: fraudproofs.FraudProof.proof_state:type_name -> fraudproofs.BytesList
+	4, // 3: fraudproofs.FraudProof.proof_read_state:type_name -> fraudproofs.BytesList
+	4, // 4: fraudproofs.FraudProof.proof_chunks:type_name -> fraudproofs.BytesList
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_fraudproofs_proto_init() }
+func file_fraudproofs_proto_init() {
+	if File_fraudproofs_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_fraudproofs_proto_rawDesc), len(file_fraudproofs_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_fraudproofs_proto_goTypes,
+		DependencyIndexes: file_fraudproofs_proto_depIdxs,
+		EnumInfos:         file_fraudproofs_proto_enumTypes,
+		MessageInfos:      file_fraudproofs_proto_msgTypes,
+	}.Build()
+	File_fraudproofs_proto = out.File
+	file_fraudproofs_proto_goTypes = nil
+	file_fraudproofs_proto_depIdxs = nil
+}
@@ -0,0 +1,145 @@
+package fraudproofs
+
+import (
+	"errors"
+	"github.com/asonnino/fraudproofs-prototype/pb"
+	"github.com/lazyledger/smt"
+)
+
+// ToProto converts a transaction into its protocol buffer.
+func (t *Transaction) ToProto() *pb.Transaction {
+	return &pb.Transaction{
+		WriteKeys: t.writeKeys,
+		NewData:   t.newData,
+		OldData:   t.oldData,
+		ReadKeys:  t.readKeys,
+		ReadData:  t.readData,
+		Arbitrary: t.arbitrary,
+		Namespace: t.namespace,
+	}
+}
+
+// TransactionFromProto converts a protocol buffer into a transaction. It returns an error if the transaction is invalid.
+func TransactionFromProto(m *pb.Transaction) (*Transaction, error) {
+	if m == nil {
+		return nil, errors.New("missing transaction")
+	}
+	return NewNamespacedTransaction(m.Namespace, m.WriteKeys, m.NewData, m.OldData, m.ReadKeys, m.ReadData, m.Arbitrary)
+}
+
+// ToProto converts a block header into its protocol buffer.
+func (h *BlockHeader) ToProto() *pb.BlockHeader {
+	return &pb.BlockHeader{
+		PrevHash:        h.prevHash,
+		Height:          h.height,
+		DataRoot:        h.dataRoot,
+		StateRoot:       h.stateRoot,
+		NumTransactions: h.numTransactions,
+		NumChunks:       h.numChunks,
+		ParamsDigest:    h.paramsDigest,
+	}
+}
+
+// BlockHeaderFromProto converts a protocol buffer into a block header.
+func BlockHeaderFromProto(m *pb.BlockHeader) (*BlockHeader, error) {
+	if m == nil {
+		return nil, errors.New("missing block header")
+	}
+	return NewBlockHeader(m.PrevHash, m.Height, m.DataRoot, m.StateRoot, m.NumTransactions, m.NumChunks,
+		m.ParamsDigest), nil
+}
+
+// bodyToProto converts the body of a block into its protocol buffer.
+func (b *Block) bodyToProto() *pb.BlockBody {
+	t := make([]*pb.Transaction, len(b.transactions))
+	for i := 0; i < len(t); i++ {
+		t[i] = b.transactions[i].ToProto()
+	}
+	return &pb.BlockBody{
+		Transactions:    t,
+		PrevStateRoot:   b.prevStateRoot,
+		InterStateRoots: b.interStateRoots,
+	}
+}
+
+// ToProto converts a fraud proof into its protocol buffer.
+func (fp *FraudProof) ToProto() *pb.FraudProof {
+	proofState := make([]*pb.BytesList, len(fp.proofState))
+	for i := 0; i < len(proofState); i++ {
+		proofState[i] = &pb.BytesList{Items: fp.proofState[i]}
+	}
+	proofReadState := make([]*pb.BytesList, len(fp.proofReadState))
+	for i := 0; i < len(proofReadState); i++ {
+		proofReadState[i] = &pb.BytesList{Items: fp.proofReadState[i]}
+	}
+	proofChunks := make([]*pb.BytesList, len(fp.proofChunks))
+	for i := 0; i < len(proofChunks); i++ {
+		proofChunks[i] = &pb.BytesList{Items: fp.proofChunks[i]}
+	}
+
+	return &pb.FraudProof{
+		Kind:           pb.FraudProof_Kind(fp.kind),
+		WriteKeys:      fp.writeKeys,
+		OldData:        fp.oldData,
+		ReadKeys:       fp.readKeys,
+		ReadData:       fp.readData,
+		ProofState:     proofState,
+		ProofReadState: proofReadState,
+		Chunks:         fp.chunks,
+		ProofChunks:    proofChunks,
+		ChunksIndexes:  fp.chunksIndexes,
+		NumOfLeaves:    fp.numOfLeaves,
+		RecordIndex:    fp.recordIndex,
+		BlockHash:      fp.blockHash,
+		AxisIndex:      fp.axisIndex,
+		ParentHeader:   fp.parentHeader,
+	}
+}
+
+// FraudProofFromProto converts a protocol buffer into a fraud proof. Malformed fraud proofs are rejected with an error,
+// as in UnmarshalBinary.
+func FraudProofFromProto(m *pb.FraudProof) (*FraudProof, error) {
+	if m == nil {
+		return nil, errors.New("missing fraud proof")
+	}
+	if m.Kind < 0 || FraudProofKind(m.Kind) > UnsortedNamespaceFraud {
+		return nil, errors.New("unsupported fraud proof kind")
+	}
+	if len(m.WriteKeys) != len(m.OldData) || len(m.WriteKeys) != len(m.ProofState) ||
+		len(m.ReadKeys) != len(m.ReadData) || len(m.ReadKeys) != len(m.ProofReadState) {
+		return nil, errors.New("number of keys does not match the number of data or proofs")
+	}
+	if len(m.Chunks) != len(m.ProofChunks) || len(m.Chunks) != len(m.ChunksIndexes) {
+		return nil, errors.New("number of chunks does not match the number of chunks proofs or indexes")
+	}
+
+	proofState := make([]smt.SparseCompactMerkleProof, len(m.ProofState))
+	for i := 0; i < len(proofState); i++ {
+		proofState[i] = m.ProofState[i].GetItems()
+	}
+	proofReadState := make([]smt.SparseCompactMerkleProof, len(m.ProofReadState))
+	for i := 0; i < len(proofReadState); i++ {
+		proofReadState[i] = m.ProofReadState[i].GetItems()
+	}
+	proofChunks := make([][][]byte, len(m.ProofChunks))
+	for i := 0; i < len(proofChunks); i++ {
+		proofChunks[i] = m.ProofChunks[i].GetItems()
+	}
+
+	return &FraudProof{
+		FraudProofKind(m.Kind),
+		m.BlockHash,
+		m.WriteKeys,
+		m.OldData,
+		m.ReadKeys,
+		m.ReadData,
+		proofState,
+		proofReadState,
+		m.Chunks,
+		proofChunks,
+		m.ChunksIndexes,
+		m.NumOfLeaves,
+		m.RecordIndex,
+		m.AxisIndex,
+		m.ParentHeader}, nil
+}
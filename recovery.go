@@ -0,0 +1,113 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"errors"
+)
+
+// RecoverBlock rebuilds the block with the given header from part of the shares of its extended data square, given row
+// by row with nil for the missing shares. Missing shares are recovered with the erasure code, and the shares must match
+// the data root of the header. The rebuilt block may be invalid: it holds the chunks as committed, and the transactions
+// and state roots that could be decoded from them, so that CheckBlock can generate a fraud proof against it.
+func RecoverBlock(header *BlockHeader, shares [][]byte, params *ChainParams, sm StateMachine) (*Block, error) {
+	// 1. recover the missing shares, and check the square against the data root
+	if !bytes.Equal(header.paramsDigest, params.Digest()) {
+		return nil, errors.New("the block does not use the given parameters")
+	}
+	k := squareWidth(header.numChunks)
+	width := 2 * k
+	if header.numChunks == 0 || width > maxSquareWidth || len(shares) != width*width {
+		return nil, errors.New("shares do not match the data square of the block")
+	}
+	shares = append([][]byte{}, shares...)
+	for i := 0; i < len(shares); i++ {
+		if shares[i] != nil && len(shares[i]) != params.shareSize() {
+			return nil, errors.New("share of the wrong size")
+		}
+	}
+	for i := 0; i < len(shares); i++ {
+		if shares[i] == nil {
+			err := recoverSquare(params, shares, width)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	square := commitSquare(params, shares, width)
+	if !bytes.Equal(square.dataRoot(params), header.dataRoot) {
+		return nil, errors.New("the shares do not match the data root of the block")
+	}
+
+	// 2. decode the transactions and state roots held by the chunks; malformed shares hold empty chunks, which are
+	// incorrectly formed
+	chunks := make([][]byte, header.numChunks)
+	for i := 0; i < len(chunks); i++ {
+		chunks[i] = shareChunk(params, shares[(i/k)*width+i%k])
+		if chunks[i] == nil {
+			chunks[i] = []byte{}
+		}
+	}
+	t, s := decodeChunks(params, chunks)
+	var prevStateRoot []byte
+	var interStateRoots [][]byte
+	if len(s) > 0 {
+		prevStateRoot, interStateRoots = s[0], s[1:]
+	}
+
+	return &Block{
+		header.prevHash,
+		header.height,
+		header.dataRoot,
+		header.stateRoot,
+		header.numTransactions,
+		t,
+		nil,
+		square,
+		chunks,
+		prevStateRoot,
+		interStateRoots,
+		params,
+		sm}, nil
+}
+
+// FetchBlock fetches the shares of the block with the given header from a source, such as a peer, and rebuilds the
+// block, which may be invalid. It first fetches the original square, and fetches the other shares only if the block
+// cannot be recovered from it, for example if some shares are withheld or if the square is not correctly erasure coded;
+// shares served with an invalid Merkle proof are discarded.
+func FetchBlock(header *BlockHeader, source ShareSource, params *ChainParams, sm StateMachine) (*Block, error) {
+	k := squareWidth(header.numChunks)
+	width := 2 * k
+	if width > maxSquareWidth {
+		return nil, errors.New("too many chunks for the data square")
+	}
+	hash := header.Hash()
+	shares := make([][]byte, width*width)
+	fetch := func(row int, col int) {
+		share, proof, err := source.GetShare(hash, row, col)
+		if err == nil && verifyShareProof(params, header.dataRoot, share, proof, row, col, width) {
+			shares[row*width+col] = share
+		}
+	}
+
+	// 1. fetch the original square, and recover the block from it
+	for row := 0; row < k; row++ {
+		for col := 0; col < k; col++ {
+			fetch(row, col)
+		}
+	}
+	b, err := RecoverBlock(header, shares, params, sm)
+	if err == nil {
+		return b, nil
+	}
+
+	// 2. fetch the other shares, and recover the block from all of them
+	for row := 0; row < width; row++ {
+		for col := 0; col < width; col++ {
+			if row >= k || col >= k {
+				fetch(row, col)
+			}
+		}
+	}
+	return RecoverBlock(header, shares, params, sm)
+}
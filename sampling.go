@@ -0,0 +1,97 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// ShareSource serves the shares of the extended data squares of blocks, along with their Merkle proofs against the
+// data roots; full nodes serve them to light clients.
+type ShareSource interface {
+	GetShare(blockHash []byte, row int, col int) ([]byte, [][]byte, error)
+}
+
+// AdmissionRule decides from its header whether a blockchain or a header chain admits a block.
+type AdmissionRule interface {
+	Admit(header *BlockHeader) error
+}
+
+// Availability is the verdict of data availability sampling on a block.
+type Availability struct {
+	Available  bool    // whether every sampled share was served with a valid Merkle proof
+	Samples    int     // number of shares served with a valid Merkle proof
+	Confidence float64 // probability that the valid samples would have hit a share withheld to prevent recovery
+}
+
+// Sampler is a data availability sampling client. It samples random shares of the extended data square of a block and
+// checks them against the data root of its header; light clients use it to make sure the data of a block can be
+// recovered, so that fraud proofs about it can be generated.
+type Sampler struct {
+	source     ShareSource
+	params     *ChainParams
+	numSamples int // number of shares sampled per block
+}
+
+// NewSampler creates a sampler requesting the given number of shares per block from the given source.
+func NewSampler(source ShareSource, params *ChainParams, numSamples int) (*Sampler, error) {
+	err := params.CheckParams()
+	if err != nil {
+		return nil, err
+	}
+	if numSamples < 1 {
+		return nil, errors.New("number of samples should be a positive integer")
+	}
+	return &Sampler{source, params, numSamples}, nil
+}
+
+// Sample samples random shares of the block with the given header, and returns the availability verdict. The block is
+// not available as soon as a share is not served, or is served with an invalid Merkle proof.
+func (s *Sampler) Sample(header *BlockHeader) (*Availability, error) {
+	if !bytes.Equal(header.paramsDigest, s.params.Digest()) {
+		return nil, errors.New("the block does not use the parameters of the sampler")
+	}
+	k := squareWidth(header.numChunks)
+	if 2*k > maxSquareWidth {
+		return &Availability{false, 0, 0}, nil
+	}
+
+	hash := header.Hash()
+	width := 2 * k
+	for i := 0; i < s.numSamples; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(width*width)))
+		if err != nil {
+			return nil, err
+		}
+		row, col := int(n.Int64())/width, int(n.Int64())%width
+		share, proof, err := s.source.GetShare(hash, row, col)
+		if err != nil || !verifyShareProof(s.params, header.dataRoot, share, proof, row, col, width) {
+			return &Availability{false, i, samplingConfidence(k, i)}, nil
+		}
+	}
+	return &Availability{true, s.numSamples, samplingConfidence(k, s.numSamples)}, nil
+}
+
+// Admit admits a block if sampling finds its data available.
+func (s *Sampler) Admit(header *BlockHeader) error {
+	availability, err := s.Sample(header)
+	if err != nil {
+		return err
+	}
+	if !availability.Available {
+		return errors.New("the block data is not available")
+	}
+	return nil
+}
+
+// samplingConfidence returns the probability that n random shares of an extended data square of width 2k hit a share
+// withheld to prevent its recovery; at least (k+1)^2 shares must be withheld for that.
+func samplingConfidence(k int, n int) float64 {
+	withheld := float64((k+1)*(k+1)) / float64(4*k*k)
+	if withheld > 1 {
+		withheld = 1
+	}
+	return 1 - math.Pow(1-withheld, float64(n))
+}
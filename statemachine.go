@@ -0,0 +1,93 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lazyledger/smt"
+)
+
+// ErrInvalidTransaction is returned by state machines when a transaction cannot be applied on top of the state.
+// Blocks containing such transactions are invalid, and a fraud proof can be generated for them.
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+// StateReader gives read access to the state.
+type StateReader interface {
+	Get(key []byte) ([]byte, error)
+}
+
+// StateMachine defines the state transition function of the blockchain.
+type StateMachine interface {
+	// Apply executes a transaction on top of the given state, and returns the keys it writes and their new data.
+	// It returns ErrInvalidTransaction if the transaction is invalid, and must return any error of the state reader
+	// unchanged (fraud proofs verifiers rely on it to detect incomplete proofs).
+	Apply(t *Transaction, state StateReader) ([][]byte, [][]byte, error)
+}
+
+// DefaultStateMachine checks that transactions read data matching the state, and writes their new data.
+type DefaultStateMachine struct{}
+
+// Apply executes a transaction on top of the given state.
+func (sm DefaultStateMachine) Apply(t *Transaction, state StateReader) ([][]byte, [][]byte, error) {
+	err := checkData(t.readKeys, t.readData, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.writeKeys, t.newData, nil
+}
+
+// CompareAndSwapStateMachine is a key-value store with compare-and-swap semantics: on top of the checks of the
+// DefaultStateMachine, the old data of the transactions must match the state.
+type CompareAndSwapStateMachine struct{}
+
+// Apply executes a transaction on top of the given state.
+func (sm CompareAndSwapStateMachine) Apply(t *Transaction, state StateReader) ([][]byte, [][]byte, error) {
+	err := checkData(t.writeKeys, t.oldData, state)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DefaultStateMachine{}.Apply(t, state)
+}
+
+// checkData returns ErrInvalidTransaction if the given keys do not map to the given data in the state.
+func checkData(keys [][]byte, data [][]byte, state StateReader) error {
+	for i := 0; i < len(keys); i++ {
+		value, err := state.Get(keys[i])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(value, data[i]) {
+			return ErrInvalidTransaction
+		}
+	}
+	return nil
+}
+
+// windowState is the state seen by a window of transactions applied on top of a state root; it records the keys read
+// from that state root.
+type windowState struct {
+	stateTree *smt.SparseMerkleTree
+	stateRoot []byte
+	writes    map[string][]byte
+	readKeys  [][]byte
+}
+
+// Get gets the value of a key.
+func (s *windowState) Get(key []byte) ([]byte, error) {
+	if value, ok := s.writes[string(key)]; ok {
+		return value, nil
+	}
+	s.readKeys = append(s.readKeys, key)
+	return s.stateTree.GetForRoot(key, s.stateRoot)
+}
+
+// proofState is the partial state built from a fraud proof.
+type proofState map[string][]byte
+
+// Get gets the value of a key.
+func (s proofState) Get(key []byte) ([]byte, error) {
+	value, ok := s[string(key)]
+	if !ok {
+		return nil, errors.New("key not in the fraud proof")
+	}
+	return value, nil
+}
@@ -0,0 +1,200 @@
+package fraudproofs
+
+import (
+	"bytes"
+	"github.com/lazyledger/smt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"sort"
+)
+
+// Storage is a key-value store in which a blockchain persists its state tree, its blocks and its tip.
+// Get must return an *smt.InvalidKeyError for missing keys, as state trees expect from their map store.
+type Storage interface {
+	smt.MapStore
+	// Keys returns the keys starting with the given prefix, in lexicographic order.
+	Keys(prefix []byte) ([][]byte, error)
+	Close() error
+}
+
+// memoryStorage is a storage holding everything in memory.
+type memoryStorage struct {
+	values map[string][]byte
+}
+
+// NewMemoryStorage creates a storage holding everything in memory; its content is lost when the program exits.
+func NewMemoryStorage() Storage {
+	return memoryStorage{make(map[string][]byte)}
+}
+
+// Get gets the value of a key.
+func (s memoryStorage) Get(key []byte) ([]byte, error) {
+	value, ok := s.values[string(key)]
+	if !ok {
+		return nil, &smt.InvalidKeyError{Key: key}
+	}
+	return value, nil
+}
+
+// Put sets the value of a key.
+func (s memoryStorage) Put(key []byte, value []byte) error {
+	s.values[string(key)] = value
+	return nil
+}
+
+// Del deletes a key.
+func (s memoryStorage) Del(key []byte) error {
+	if _, ok := s.values[string(key)]; !ok {
+		return &smt.InvalidKeyError{Key: key}
+	}
+	delete(s.values, string(key))
+	return nil
+}
+
+// Keys returns the keys starting with the given prefix, in lexicographic order.
+func (s memoryStorage) Keys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	for key := range s.values {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, []byte(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+// Close closes the storage.
+func (s memoryStorage) Close() error {
+	return nil
+}
+
+// levelDBStorage is a storage backed by an embedded LevelDB database.
+type levelDBStorage struct {
+	db *leveldb.DB
+}
+
+// OpenLevelDBStorage opens the LevelDB database stored in the given directory, and creates it if it does not exist.
+func OpenLevelDBStorage(dir string) (Storage, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBStorage{db}, nil
+}
+
+// Get gets the value of a key.
+func (s *levelDBStorage) Get(key []byte) ([]byte, error) {
+	value, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, &smt.InvalidKeyError{Key: key}
+	}
+	return value, err
+}
+
+// Put sets the value of a key.
+func (s *levelDBStorage) Put(key []byte, value []byte) error {
+	return s.db.Put(key, value, nil)
+}
+
+// Del deletes a key.
+func (s *levelDBStorage) Del(key []byte) error {
+	return s.db.Delete(key, nil)
+}
+
+// Keys returns the keys starting with the given prefix, in lexicographic order.
+func (s *levelDBStorage) Keys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	for iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	return keys, iter.Error()
+}
+
+// Close closes the storage.
+func (s *levelDBStorage) Close() error {
+	return s.db.Close()
+}
+
+// prefixStore is a namespace of a storage, in which every key is prefixed.
+type prefixStore struct {
+	storage Storage
+	prefix  []byte
+}
+
+// key returns the key of the storage under which the given key is stored.
+func (s prefixStore) key(key []byte) []byte {
+	return append(append([]byte{}, s.prefix...), key...)
+}
+
+// Get gets the value of a key.
+func (s prefixStore) Get(key []byte) ([]byte, error) {
+	return s.storage.Get(s.key(key))
+}
+
+// Put sets the value of a key.
+func (s prefixStore) Put(key []byte, value []byte) error {
+	return s.storage.Put(s.key(key), value)
+}
+
+// Del deletes a key.
+func (s prefixStore) Del(key []byte) error {
+	return s.storage.Del(s.key(key))
+}
+
+// stateView is a copy-on-write view of a map store: writes are kept in memory until they are committed, so that the
+// writes of a rejected block can be discarded and leave the store untouched.
+type stateView struct {
+	store  smt.MapStore
+	writes map[string][]byte // new values of the written keys, or nil for deleted keys
+}
+
+// newStateView creates a view of the given map store.
+func newStateView(store smt.MapStore) *stateView {
+	return &stateView{store, make(map[string][]byte)}
+}
+
+// Get gets the value of a key.
+func (v *stateView) Get(key []byte) ([]byte, error) {
+	value, ok := v.writes[string(key)]
+	if !ok {
+		return v.store.Get(key)
+	}
+	if value == nil {
+		return nil, &smt.InvalidKeyError{Key: key}
+	}
+	return value, nil
+}
+
+// Put sets the value of a key.
+func (v *stateView) Put(key []byte, value []byte) error {
+	v.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Del deletes a key.
+func (v *stateView) Del(key []byte) error {
+	v.writes[string(key)] = nil
+	return nil
+}
+
+// commit writes the writes of the view to the underlying map store.
+func (v *stateView) commit() error {
+	for key, value := range v.writes {
+		var err error
+		if value == nil {
+			err = v.store.Del([]byte(key))
+			if _, ok := err.(*smt.InvalidKeyError); ok {
+				err = nil
+			}
+		} else {
+			err = v.store.Put([]byte(key), value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	v.writes = make(map[string][]byte)
+	return nil
+}
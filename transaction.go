@@ -6,9 +6,19 @@ import (
 	"crypto/sha512"
 )
 
-// MaxSize is the number of bytes dedicated to store the size of the transaction's fields.
-// TODO: this field cannot be changed because of the function 'binary.LittleEndian.PutUint16'
-const MaxSize int = 2
+// TransactionFormat is the format version of serialized transactions, in which lengths are varints and the namespace
+// comes first.
+const TransactionFormat byte = 3
+
+// Errors returned by Deserialize on malformed input, so that verifiers can tell them apart from invalid transactions.
+var (
+	// ErrTruncated is returned when the input ends before the end of the serialized transaction.
+	ErrTruncated = errors.New("truncated transaction")
+	// ErrTrailingBytes is returned when the input goes on after the end of the serialized transaction.
+	ErrTrailingBytes = errors.New("trailing bytes after transaction")
+	// ErrFieldTooLarge is returned when a field of the transaction is larger than the transaction holding it.
+	ErrFieldTooLarge = errors.New("transaction field larger than the transaction")
+)
 
 // Transaction is a transaction of the blockchain.
 // It is designed only for testing & benchmarking as it is implemented very naively.
@@ -19,12 +29,21 @@ type Transaction struct {
 	readKeys [][]byte
 	readData [][]byte
 	arbitrary []byte
+	namespace []byte // namespace ID of the transaction, empty if the chain does not use namespaces
 }
 
-// NewTransaction creates a new transaction with the given keys and data.
+// NewTransaction creates a new transaction with the given keys and data, for chains that do not use namespaces.
 func NewTransaction(writeKeys, newData, oldData, readKeys, readData [][]byte, arbitrary []byte) (*Transaction, error) {
+	return NewNamespacedTransaction(nil, writeKeys, newData, oldData, readKeys, readData, arbitrary)
+}
+
+// NewNamespacedTransaction creates a new transaction of the given namespace with the given keys and data. Blocks only
+// admit namespace IDs of the namespace size of the chain, other than the largest one, which is reserved for padding and
+// parity shares.
+func NewNamespacedTransaction(namespace []byte, writeKeys, newData, oldData, readKeys, readData [][]byte,
+	arbitrary []byte) (*Transaction, error) {
 	t := &Transaction{
-		writeKeys,newData,oldData,readKeys,readData,arbitrary}
+		writeKeys,newData,oldData,readKeys,readData,arbitrary,namespace}
 	err := t.CheckTransaction()
 	if err != nil {
 		return nil, err
@@ -32,15 +51,46 @@ func NewTransaction(writeKeys, newData, oldData, readKeys, readData [][]byte, ar
 	return t, nil
 }
 
+// WriteKeys returns the keys written by the transaction.
+func (t *Transaction) WriteKeys() [][]byte {
+	return t.writeKeys
+}
+
+// NewData returns the data written by the transaction.
+func (t *Transaction) NewData() [][]byte {
+	return t.newData
+}
+
+// OldData returns the data expected by the transaction at its write keys before it is applied.
+func (t *Transaction) OldData() [][]byte {
+	return t.oldData
+}
+
+// ReadKeys returns the keys read by the transaction.
+func (t *Transaction) ReadKeys() [][]byte {
+	return t.readKeys
+}
+
+// ReadData returns the data read by the transaction.
+func (t *Transaction) ReadData() [][]byte {
+	return t.readData
+}
+
+// Arbitrary returns the arbitrary data of the transaction.
+func (t *Transaction) Arbitrary() []byte {
+	return t.arbitrary
+}
+
+// Namespace returns the namespace ID of the transaction.
+func (t *Transaction) Namespace() []byte {
+	return t.namespace
+}
+
 // CheckTransaction verifies whether a transaction is well-formed.
 func (t *Transaction) CheckTransaction() (error) {
 	if len(t.writeKeys) != len(t.newData) || len(t.writeKeys) != len(t.oldData) || len(t.readKeys) != len(t.readData) {
 		return errors.New("number of keys does not match the number of data")
 	}
-	if len(t.writeKeys) != len(t.readKeys) || len(t.arbitrary) != 0{
-		return errors.New("number of writeKeys should be equal to number of readKeys, and arbitrary data should" +
-			"be empty; sorry for that (lazy implementation)")
-	}
 
 	return nil
 }
@@ -55,73 +105,106 @@ func (t *Transaction) HashKey() [256]byte {
 }
 
 // Serialize converts a transaction into an array of bytes.
-// TODO: replace by a proper protocol buffer
+// The serialized transaction is prefixed by its length, and starts with its format version followed by its namespace
+// ID, prefixed by its length. Each list of keys or data is prefixed by its number of elements, and each element by its
+// length, so that malformed transactions are serialized as is; the arbitrary data comes last, prefixed by its length.
+// All lengths are varints, so transactions of any size can be serialized.
+// This is the encoding committed in the data square; clients in other languages can use ToProto instead.
 func (t *Transaction) Serialize() []byte {
-	var buff []byte
-
-	numKeys := make([]byte, MaxSize)
-	binary.LittleEndian.PutUint16(numKeys, uint16(len(t.writeKeys)))
-	buff = append(buff, numKeys...)
-
-	for i := 0; i < len(t.writeKeys); i++ {
-		size := make([]byte, MaxSize)
-		binary.LittleEndian.PutUint16(size, uint16(len(t.writeKeys[i])))
-		buff = append(buff, size...)
-		buff = append(buff, t.writeKeys[i]...)
-
-		size = make([]byte, MaxSize)
-		binary.LittleEndian.PutUint16(size, uint16(len(t.newData[i])))
-		buff = append(buff, size...)
-		buff = append(buff, t.newData[i]...)
-
-		size = make([]byte, MaxSize)
-		binary.LittleEndian.PutUint16(size, uint16(len(t.oldData[i])))
-		buff = append(buff, size...)
-		buff = append(buff, t.oldData[i]...)
-
-		size = make([]byte, MaxSize)
-		binary.LittleEndian.PutUint16(size, uint16(len(t.readKeys[i])))
-		buff = append(buff, size...)
-		buff = append(buff, t.readKeys[i]...)
-
-		size = make([]byte, MaxSize)
-		binary.LittleEndian.PutUint16(size, uint16(len(t.readData[i])))
-		buff = append(buff, size...)
-		buff = append(buff, t.readData[i]...)
+	buff := []byte{TransactionFormat}
+	buff = appendSize(buff, len(t.namespace))
+	buff = append(buff, t.namespace...)
+
+	for _, list := range [][][]byte{t.writeKeys, t.newData, t.oldData, t.readKeys, t.readData} {
+		buff = appendSize(buff, len(list))
+		for i := 0; i < len(list); i++ {
+			buff = appendSize(buff, len(list[i]))
+			buff = append(buff, list[i]...)
+		}
 	}
+	buff = appendSize(buff, len(t.arbitrary))
+	buff = append(buff, t.arbitrary...)
 
-	length := make([]byte, MaxSize)
-	binary.LittleEndian.PutUint16(length, uint16(len(buff)+MaxSize))
-	buff = append(length, buff...)
-
-	return buff
+	return append(appendSize(nil, len(buff)), buff...)
 }
 
 // Deserialize converts a serialized transaction (ie. array of bytes) into a transaction structure.
-// TODO: replace by a proper protocol buffer
+// It never panics: it returns ErrTruncated, ErrTrailingBytes or ErrFieldTooLarge if the serialized transaction is
+// malformed, and another error if its format is unknown or if it decodes to an invalid transaction.
 func Deserialize(buff []byte) (*Transaction, error) {
-	var writeKeys, newData, oldData, readKeys, readData [][]byte
-
-	tmp, size := make([]byte, len(buff)), uint16(0)
-	copy(tmp, buff)
-	_, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:] // length
-	numKeys, tmp := binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-	for i := 0; i < int(numKeys); i++ {
-		size, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-		writeKeys, tmp = append(writeKeys, tmp[:size]), tmp[size:]
-
-		size, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-		newData, tmp = append(newData, tmp[:size]), tmp[size:]
+	length, n := binary.Uvarint(buff)
+	if n == 0 {
+		return nil, ErrTruncated
+	}
+	if n < 0 {
+		return nil, ErrFieldTooLarge
+	}
+	tmp := buff[n:]
+	if length > uint64(len(tmp)) {
+		return nil, ErrTruncated
+	}
+	if length < uint64(len(tmp)) {
+		return nil, ErrTrailingBytes
+	}
+	if length == 0 || tmp[0] != TransactionFormat {
+		return nil, errors.New("unsupported transaction format")
+	}
+	tmp = tmp[1:]
+	size, tmp, err := nextSize(tmp)
+	if err != nil {
+		return nil, err
+	}
+	namespace := append([]byte{}, tmp[:size]...)
+	tmp = tmp[size:]
+
+	lists := make([][][]byte, 5) // writeKeys, newData, oldData, readKeys, readData
+	for i := 0; i < len(lists); i++ {
+		var numItems int
+		numItems, tmp, err = nextSize(tmp)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < numItems; j++ {
+			size, tmp, err = nextSize(tmp)
+			if err != nil {
+				return nil, err
+			}
+			lists[i] = append(lists[i], append([]byte{}, tmp[:size]...))
+			tmp = tmp[size:]
+		}
+	}
+	size, tmp, err = nextSize(tmp)
+	if err != nil {
+		return nil, err
+	}
+	arbitrary := append([]byte{}, tmp[:size]...)
+	tmp = tmp[size:]
+	if len(tmp) != 0 {
+		return nil, ErrTrailingBytes
+	}
 
-		size, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-		oldData, tmp = append(oldData, tmp[:size]), tmp[size:]
+	if len(namespace) == 0 {
+		namespace = nil
+	}
+	return NewNamespacedTransaction(namespace, lists[0], lists[1], lists[2], lists[3], lists[4], arbitrary)
+}
 
-		size, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-		readKeys, tmp = append(readKeys, tmp[:size]), tmp[size:]
+// appendSize appends a varint length to the buffer.
+func appendSize(buff []byte, n int) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buff, tmp[:binary.PutUvarint(tmp, uint64(n))]...)
+}
 
-		size, tmp = binary.LittleEndian.Uint16(tmp[:MaxSize]), tmp[MaxSize:]
-		readData, tmp = append(readData, tmp[:size]), tmp[size:]
+// nextSize reads the varint length of a field at the beginning of the buffer, and returns it along with the rest of the
+// buffer. Lengths larger than the rest of the buffer are rejected, so they cannot be truncated or trigger huge
+// allocations.
+func nextSize(buff []byte) (int, []byte, error) {
+	size, n := binary.Uvarint(buff)
+	if n == 0 {
+		return 0, nil, ErrTruncated
 	}
-
-	return NewTransaction(writeKeys, newData, oldData, readKeys, readData, []byte{})
+	if n < 0 || size > uint64(len(buff)-n) {
+		return 0, nil, ErrFieldTooLarge
+	}
+	return int(size), buff[n:], nil
 }